@@ -3,6 +3,8 @@ package apio
 import (
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"strings"
@@ -19,6 +21,8 @@ type Api struct {
 	Servers     []Server
 	IntBasePath string
 	Endpoints   []EndpointBase
+	Middlewares []Middleware
+	Verifiers   []SchemeVerifier
 }
 
 type Server struct {
@@ -36,13 +40,49 @@ func (a Api) WithEndpoints(endpoint ...EndpointBase) Api {
 	return a
 }
 
+func (a Api) WithMiddlewares(middleware ...Middleware) Api {
+	a.Middlewares = append(a.Middlewares, middleware...)
+	return a
+}
+
+// WithVerifiers adds verifiers of security schemes. Requests to endpoints
+// that are not Secured are then rejected, unless they carry credentials
+// that one of the verifiers accepts.
+func (a Api) WithVerifiers(verifier ...SchemeVerifier) Api {
+	a.Verifiers = append(a.Verifiers, verifier...)
+	return a
+}
+
 func (a Api) Validate(isServer bool) Api {
 	for _, e := range a.Endpoints {
 		e.validate(isServer)
+		if isServer {
+			a.warnUnverifiedSchemes(e)
+		}
 	}
 	return a
 }
 
+func (a Api) warnUnverifiedSchemes(e EndpointBase) {
+	if _, ok := e.(securedEndpoint); ok {
+		return
+	}
+	var unverified []string
+	for _, scheme := range e.GetSecurity() {
+		if findVerifier(a.Verifiers, scheme) == nil {
+			unverified = append(unverified, scheme.Name)
+		}
+	}
+	if len(unverified) == 0 {
+		return
+	}
+	if len(unverified) == len(e.GetSecurity()) {
+		slog.Warn(fmt.Sprintf("security of endpoint %s is not enforced, use Secured or Api.WithVerifiers", e.GetId()))
+	} else {
+		slog.Warn(fmt.Sprintf("endpoint %s rejects credentials of schemes %v, as they have no verifier", e.GetId(), unverified))
+	}
+}
+
 type ErrResp struct {
 	Status int
 	ClMsg  string
@@ -80,16 +120,51 @@ type EndpointBase interface {
 	GetInput() EndpointInputBase
 	OkCode() int
 	GetTags() []string
+	GetRequestExamples() map[string]Example
+	GetResponseExamples() map[string]Example
+	GetSecurity() []SecurityScheme
+	GetScopes() []string
+	GetConsumes() []string
+	GetProduces() []string
+	GetMaxBodyBytes() int64
+	GetQueryNaming() NamingPolicy
+}
+
+// Example is a named request or response body example, published in the OpenAPI spec
+type Example struct {
+	Summary     string
+	Description string
+	Value       any
 }
 
 type Endpoint[Input EndpointInputBase, Output EndpointOutputBase] struct {
-	ID             string
-	Name           string
-	Summary        string
-	Description    string
-	Method         string
-	Handler        func(Input) (Output, error)
-	Tags           []string
+	ID          string
+	Name        string
+	Summary     string
+	Description string
+	Method      string
+	Handler     func(Input) (Output, error)
+	Tags        []string
+	// RequestExamples are example request bodies, keyed by example name
+	RequestExamples map[string]Example
+	// ResponseExamples are example response bodies, keyed by example name
+	ResponseExamples map[string]Example
+	// Security lists the accepted security schemes, any one of them is enough.
+	// They are published and injected by RPC, but only enforced by the server
+	// for schemes with a verifier (see Api.WithVerifiers), or by Secured.
+	Security []SecurityScheme
+	// Scopes that the credentials must grant, e.g. enforced by the JWTVerifier
+	Scopes []string
+	// Consumes lists the request body media types, the first one is used by RPC. JSON if empty.
+	Consumes []string
+	// Produces lists the response body media types, picked by the Accept header. JSON if empty.
+	Produces []string
+	// MaxBodyBytes limits the size of request bodies, unlimited if 0. Larger requests get 413.
+	MaxBodyBytes int64
+	// QueryNaming names the query parameters, e.g. SnakeCase. Field names are
+	// used as is if nil, and name tags take precedence. Set it where the
+	// endpoint is declared, so that clients and servers share the policy.
+	QueryNaming    NamingPolicy
 	headerBindings *HeaderBindings
 	pathBindings   *PathBindings
 	queryBindings  *QueryBindings
@@ -114,6 +189,65 @@ func (e Endpoint[Input, Output]) GetTags() []string {
 	return e.Tags
 }
 
+func (e Endpoint[Input, Output]) GetRequestExamples() map[string]Example {
+	return e.RequestExamples
+}
+
+func (e Endpoint[Input, Output]) GetResponseExamples() map[string]Example {
+	return e.ResponseExamples
+}
+
+func (e Endpoint[Input, Output]) GetSecurity() []SecurityScheme {
+	return e.Security
+}
+
+func (e Endpoint[Input, Output]) GetScopes() []string {
+	return e.Scopes
+}
+
+func (e Endpoint[Input, Output]) GetConsumes() []string {
+	if len(e.Consumes) == 0 {
+		var zero Input
+		bodyT := reflect.TypeOf(zero.getBody())
+		if isItemsType(bodyT) {
+			return itemsMediaTypes
+		}
+		if isPatchType(bodyT) {
+			return []string{patchBodyOf(bodyT).patchMediaType()}
+		}
+		return []string{MediaTypeJson}
+	}
+	return e.Consumes
+}
+
+func (e Endpoint[Input, Output]) GetProduces() []string {
+	if len(e.Produces) == 0 {
+		if e.isStreamOutput() {
+			return []string{MediaTypeOctetStream}
+		}
+		var zero Output
+		if isItemsType(reflect.TypeOf(zero.getBody())) {
+			return itemsMediaTypes
+		}
+		return []string{MediaTypeJson}
+	}
+	return e.Produces
+}
+
+func (e Endpoint[Input, Output]) isStreamOutput() bool {
+	var zero Output
+	_, isStream := zero.GetStream()
+	return isStream
+}
+
+func (e Endpoint[Input, Output]) GetQueryNaming() NamingPolicy {
+	return e.QueryNaming
+}
+
+func (e Endpoint[Input, Output]) GetMaxBodyBytes() int64 {
+	return e.MaxBodyBytes
+}
+
 func (e Endpoint[Input, Output]) GetId() string {
 	if e.ID != "" {
 		return e.ID
@@ -255,7 +389,7 @@ func (e Endpoint[Input, Output]) getPathBindings() PathBindings {
 
 func (e Endpoint[Input, Output]) getQueryBindings() QueryBindings {
 	if e.queryBindings == nil {
-		b := calcQueryBindings[Input]()
+		b := calcQueryBindings[Input](e.QueryNaming)
 		e.queryBindings = &b
 	}
 	return *e.queryBindings
@@ -278,33 +412,101 @@ func (e Endpoint[Input, Output]) validateOutputHeadersType() {
 }
 
 func (e Endpoint[Input, Output]) Handle(payload InputPayload) (EndpointOutputBase, error) {
-	var zeroInput Input
 	var zeroOutput Output
 
-	// make header keys lower case
-	for k, v := range payload.Headers {
-		delete(payload.Headers, k)
-		payload.Headers[strings.ToLower(k)] = v
+	input, err := e.parseInput(payload)
+	if err != nil {
+		return zeroOutput, err
+	}
+	defer closeFiles(input.getBody())
+	output, err := e.Handler(input)
+	if err != nil {
+		return zeroOutput, handlerError(err)
 	}
+	return output, nil
+}
+
+func (e Endpoint[Input, Output]) parseInput(payload InputPayload) (Input, error) {
+	var zeroInput Input
+
+	normalizeHeaders(payload)
 
-	input, err := zeroInput.parse(payload, e.getHeaderBindings(), e.getPathBindings(), e.getQueryBindings())
+	codec, err := e.requestCodec(payload)
 	if err != nil {
-		return zeroOutput, NewError(http.StatusBadRequest, fmt.Sprintf("failed to parse input: %v", err), err)
+		return zeroInput, err
 	}
-	inputAsInput, ok := input.(Input)
-	if !ok {
-		return zeroOutput, NewError(http.StatusInternalServerError, fmt.Sprintf("failed to cast input to %t", reflect.TypeOf(zeroInput)), nil)
+
+	if e.MaxBodyBytes > 0 {
+		if int64(len(payload.Body)) > e.MaxBodyBytes {
+			return zeroInput, bodyTooLarge(e.MaxBodyBytes)
+		}
+		if payload.BodyReader != nil {
+			payload.BodyReader = http.MaxBytesReader(nil, io.NopCloser(payload.BodyReader), e.MaxBodyBytes)
+		}
 	}
-	output, err := e.Handler(inputAsInput)
+
+	input, err := zeroInput.parse(payload, codec, e.getHeaderBindings(), e.getPathBindings(), e.getQueryBindings())
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return zeroInput, bodyTooLarge(maxBytesErr.Limit)
+		}
 		var errResp *ErrResp
 		if errors.As(err, &errResp) {
-			return zeroOutput, errResp
-		} else {
-			return zeroOutput, NewError(http.StatusInternalServerError, fmt.Sprintf("failed to run endpoint handler: %v", err), err)
+			return zeroInput, errResp
 		}
+		return zeroInput, NewError(http.StatusBadRequest, fmt.Sprintf("failed to parse input: %v", err), err)
+	}
+	inputAsInput, ok := input.(Input)
+	if !ok {
+		return zeroInput, NewError(http.StatusInternalServerError, fmt.Sprintf("failed to cast input to %t", reflect.TypeOf(zeroInput)), nil)
+	}
+	return inputAsInput, nil
+}
+
+// requestCodec returns the codec of the request body, from its Content-Type
+// header. Requests without one are assumed to use the first consumed type.
+func (e Endpoint[Input, Output]) requestCodec(payload InputPayload) (Codec, error) {
+	consumes := e.GetConsumes()
+	contentType := headerValue(payload.Headers, "Content-Type")
+	bodyInfo := e.GetBodyInputInfo()
+	if contentType == "" || !bodyInfo.HasContent() {
+		return mustGetCodec(consumes[0]), nil
+	}
+	for _, mediaType := range consumes {
+		if baseMediaType(mediaType) == baseMediaType(contentType) {
+			return mustGetCodec(mediaType), nil
+		}
+	}
+	return Codec{}, NewError(http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content type '%s', expected one of %v", contentType, consumes), nil)
+}
+
+func bodyTooLarge(limit int64) error {
+	return NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body larger than %d bytes", limit), nil)
+}
+
+// normalizeHeaders makes header keys lower case, merging keys that only differ in case
+func normalizeHeaders(payload InputPayload) {
+	normalized := make(map[string][]string, len(payload.Headers))
+	for k, v := range payload.Headers {
+		lk := strings.ToLower(k)
+		normalized[lk] = append(normalized[lk], v...)
+	}
+	for k := range payload.Headers {
+		delete(payload.Headers, k)
+	}
+	for k, v := range normalized {
+		payload.Headers[k] = v
+	}
+}
+
+func handlerError(err error) error {
+	var errResp *ErrResp
+	if errors.As(err, &errResp) {
+		return errResp
+	} else {
+		return NewError(http.StatusInternalServerError, fmt.Sprintf("failed to run endpoint handler: %v", err), err)
 	}
-	return output, nil
 }
 
 func AsErResp(err error) *ErrResp {
@@ -336,6 +538,20 @@ func (e Endpoint[Input, Output]) validate(isServer bool) {
 			panic("handler is nil for endpoint " + e.GetId())
 		}
 	}
+	for _, scheme := range e.Security {
+		if err := scheme.validate(); err != nil {
+			panic(fmt.Sprintf("invalid security scheme for endpoint %s: %v", e.GetId(), err))
+		}
+	}
+	mediaTypes := e.GetConsumes()
+	if !e.isStreamOutput() { // streams have their own content types
+		mediaTypes = append(mediaTypes, e.GetProduces()...)
+	}
+	for _, mediaType := range mediaTypes {
+		if _, ok := GetCodec(mediaType); !ok {
+			panic(fmt.Sprintf("no codec registered for media type '%s' in endpoint %s", mediaType, e.GetId()))
+		}
+	}
 	e.getHeaderBindings() // panics if invalid
 	e.getPathBindings()   // panics if invalid
 	e.getQueryBindings()  // panics if invalid
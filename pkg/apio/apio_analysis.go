@@ -20,6 +20,10 @@ type FieldInfo struct {
 	ValueType    reflect.Type
 	Index        int
 	IsPointer    bool
+	Description  string
+	Example      string
+	Deprecated   bool
+	Pattern      string // regular expression that values must fully match, if not empty
 }
 
 func (a *FieldInfo) HasFieldNameInStruct() bool {
@@ -40,18 +44,57 @@ func (a *FieldInfo) String() string {
 	result += fmt.Sprintf(" ValueType: %v\n", a.ValueType)
 	result += fmt.Sprintf(" Index: %v\n", a.Index)
 	result += fmt.Sprintf(" IsPointer: %v\n", a.IsPointer)
+	result += fmt.Sprintf(" Description: %v\n", a.Description)
+	result += fmt.Sprintf(" Example: %v\n", a.Example)
+	result += fmt.Sprintf(" Deprecated: %v\n", a.Deprecated)
+	result += fmt.Sprintf(" Pattern: %v\n", a.Pattern)
 	result += "}"
 	return result
 }
 
 func (a *FieldInfo) IsRequired() bool {
-	return !a.IsPointer
+	return !a.IsPointer && !a.IsNullable()
 }
 
 func (a *FieldInfo) IsOptional() bool {
 	return !a.IsRequired()
 }
 
+// HasExample returns true if the field has an `example:"..."` tag
+func (a *FieldInfo) HasExample() bool {
+	_, ok := a.StructField.Tag.Lookup("example")
+	return ok
+}
+
+// ExampleValue returns the example tag parsed into the field's value type,
+// falling back to the raw string if it cannot be parsed.
+func (a *FieldInfo) ExampleValue() any {
+	if a.ValueType == nil || a.ValueType.Kind() == reflect.String {
+		return a.Example
+	}
+	parseFn, err := getStringParsePtrFn(a.ValueType)
+	if err != nil {
+		return a.Example
+	}
+	parsedPtr, err := parseFn(a.Example)
+	if err != nil {
+		return a.Example
+	}
+	return reflect.ValueOf(parsedPtr).Elem().Interface()
+}
+
+// IsCookie returns true if the field has an `in:"cookie"` tag, i.e. it is
+// read from the Cookie header rather than being a header of its own
+func (a *FieldInfo) IsCookie() bool {
+	return a.StructField.Tag.Get("in") == "cookie"
+}
+
+// IsCatchAll returns true if the field has a `path:"*"` tag, i.e. it binds
+// the rest of the path, including any slashes
+func (a *FieldInfo) IsCatchAll() bool {
+	return a.HasName() && a.StructField.Tag.Get("path") == "*"
+}
+
 func (a *FieldInfo) IsSlice() bool {
 	return a.Type.Kind() == reflect.Slice
 }
@@ -99,6 +142,7 @@ func (a *FieldInfo) GetPtr(parentPtr any) (any, error) {
 type StructInfo struct {
 	Name              string
 	Pkg               string
+	Type              reflect.Type // the struct type, or the element type if IsSlice
 	Fields            []FieldInfo
 	FieldsByFieldName map[string]FieldInfo
 	FieldsByName      map[string]FieldInfo
@@ -127,9 +171,15 @@ func GetFieldInfoOfType(parentT reflect.Type, index int) (FieldInfo, error) {
 	}
 	lkName := camelCaseToKebabCase(name)
 
+	description := structField.Tag.Get("desc")
+	example := structField.Tag.Get("example")
+	deprecated := strings.ToLower(structField.Tag.Get("deprecated")) == "true"
+
 	valueType := fieldType
 	if fieldType.Kind() == reflect.Ptr {
 		valueType = fieldType.Elem()
+	} else if optionalValueType, ok := OptionalValueType(fieldType); ok {
+		valueType = optionalValueType
 	}
 
 	return FieldInfo{
@@ -142,6 +192,10 @@ func GetFieldInfoOfType(parentT reflect.Type, index int) (FieldInfo, error) {
 		ValueType:    valueType,
 		Index:        index,
 		IsPointer:    isPointer,
+		Description:  description,
+		Example:      example,
+		Deprecated:   deprecated,
+		Pattern:      structField.Tag.Get("pattern"),
 	}, nil
 }
 
@@ -168,6 +222,13 @@ func GetStructInfo[T any](t T) (StructInfo, error) {
 }
 func GetStructInfoOfType(tpe reflect.Type) (StructInfo, error) {
 
+	if isItemsType(tpe) {
+		return GetStructInfoOfType(reflect.SliceOf(reflect.Zero(tpe).Interface().(ItemsBody).ItemType()))
+	}
+	if isPatchType(tpe) {
+		return GetStructInfoOfType(patchBodyOf(tpe).patchSchemaType())
+	}
+
 	// Check that it is a struct
 	if tpe.Kind() != reflect.Struct {
 		if tpe.Kind() == reflect.Slice {
@@ -183,9 +244,10 @@ func GetStructInfoOfType(tpe reflect.Type) (StructInfo, error) {
 
 	structPkg := tpe.PkgPath()
 	structName := tpe.Name()
-	fullPath := fmt.Sprintf("%v/%v", structPkg, structName)
 
-	cached, isCached := cache.Load(fullPath)
+	// cache by type, since anonymous structs and types declared in different
+	// functions can share the same package and name
+	cached, isCached := cache.Load(tpe)
 	if isCached {
 		return cached.(StructInfo), nil
 	}
@@ -221,11 +283,12 @@ func GetStructInfoOfType(tpe reflect.Type) (StructInfo, error) {
 	analyzed := StructInfo{
 		Name:              structName,
 		Pkg:               structPkg,
+		Type:              tpe,
 		Fields:            fields,
 		FieldsByFieldName: fieldsByFieldName,
 		FieldsByName:      fieldsByName,
 		FieldsByLKName:    fieldsByLKName,
 	}
-	cache.Store(fullPath, analyzed)
+	cache.Store(tpe, analyzed)
 	return analyzed, nil
 }
@@ -1,15 +1,23 @@
 package apio
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type RPCOpts struct {
 	Timeout time.Duration
+	// Credentials to send, keyed by security scheme name.
+	// The first of the endpoint's security schemes with credentials is used.
+	Credentials map[string]Credentials
+	// Signer signs the requests, if set
+	Signer *RequestSigner
+	// Jar stores cookies set by responses and sends them with later requests, if set
+	Jar http.CookieJar
 }
 
 func DefaultOpts() RPCOpts {
@@ -18,28 +26,54 @@ func DefaultOpts() RPCOpts {
 	}
 }
 
-func (e Endpoint[Input, Output]) RPC(
-	server Server,
-	input Input,
-	opts RPCOpts,
-) (Output, error) {
-
-	if e.Handler != nil { // means we are testing locally, and have mocked the other side
-		return e.Handler(input)
+// WithCredentials returns a copy of the opts, with credentials for the named security scheme
+func (o RPCOpts) WithCredentials(schemeName string, creds Credentials) RPCOpts {
+	credentials := make(map[string]Credentials, len(o.Credentials)+1)
+	for k, v := range o.Credentials {
+		credentials[k] = v
 	}
+	credentials[schemeName] = creds
+	o.Credentials = credentials
+	return o
+}
 
-	var result Output
-	payload, err := input.ToPayload()
+// ToPayload converts the input to a payload, encoding the body with the first
+// of the endpoint's media types and naming query parameters with its QueryNaming
+func (e Endpoint[Input, Output]) ToPayload(input Input) (InputPayload, error) {
+	return input.toPayload(mustGetCodec(e.GetConsumes()[0]), e.QueryNaming)
+}
+
+// requestPayload converts the input to a payload, with content type headers, and injects any credentials
+func (e Endpoint[Input, Output]) requestPayload(input Input, opts RPCOpts) (InputPayload, error) {
+	mediaType := e.GetConsumes()[0]
+	payload, err := e.ToPayload(input)
 	if err != nil {
-		return result, fmt.Errorf("failed to convert input to payload: %w", err)
+		return payload, fmt.Errorf("failed to convert input to payload: %w", err)
 	}
-
-	// Make http call
-	client := http.Client{
-		Timeout: opts.Timeout,
+	bodyInfo := input.GetBodyInfo()
+	if bodyInfo.HasContent() && headerValue(payload.Headers, "Content-Type") == "" {
+		payload.Headers["Content-Type"] = []string{mediaType}
+	}
+	if headerValue(payload.Headers, "Accept") == "" {
+		payload.Headers["Accept"] = []string{strings.Join(e.GetProduces(), ", ")}
 	}
-	bodyIoReader := bytes.NewReader(payload.Body)
-	fullPath := fmt.Sprintf("%s://%s:%d%s%s%s",
+	for _, scheme := range e.Security {
+		if creds, ok := opts.Credentials[scheme.Name]; ok {
+			scheme.Inject(&payload, creds)
+			break
+		}
+	}
+	if opts.Signer != nil {
+		if err := opts.Signer.Sign(e.Method, &payload); err != nil {
+			return payload, fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
+	return payload, nil
+}
+
+// requestUrl returns the full url of a payload
+func requestUrl(server Server, payload InputPayload) string {
+	return fmt.Sprintf("%s://%s:%d%s%s%s",
 		server.Scheme,
 		server.Host,
 		server.Port,
@@ -47,27 +81,63 @@ func (e Endpoint[Input, Output]) RPC(
 		payload.PathStr,
 		payload.QueryString(),
 	)
-	req, err := http.NewRequest(
-		e.Method,
-		fullPath,
-		bodyIoReader,
-	)
+}
 
+// newRequest creates the http request of a payload
+func newRequest(ctx context.Context, method string, server Server, payload InputPayload) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl(server, payload), payload.bodyReader())
 	if err != nil {
-		return result, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-
 	for k, vs := range payload.Headers {
 		for _, v := range vs {
 			req.Header.Add(k, v)
 		}
 	}
+	return req, nil
+}
+
+func (e Endpoint[Input, Output]) RPC(
+	server Server,
+	input Input,
+	opts RPCOpts,
+) (Output, error) {
+
+	if e.Handler != nil { // means we are testing locally, and have mocked the other side
+		return e.Handler(input)
+	}
+
+	var result Output
+	payload, err := e.requestPayload(input, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// Make http call
+	client := http.Client{
+		Timeout: opts.Timeout,
+		Jar:     opts.Jar,
+	}
+	req, err := newRequest(context.Background(), e.Method, server, payload)
+	if err != nil {
+		return result, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return result, fmt.Errorf("failed to make request: %w", err)
 	}
 
+	if result.isStreamed() && resp.StatusCode/100 == 2 {
+		// the caller reads and closes the body
+		resultUntyped, err := result.SetHeaders(resp.Header)
+		if err != nil {
+			_ = resp.Body.Close()
+			return result, fmt.Errorf("failed to set headers: %w", err)
+		}
+		return resultUntyped.withStream(streamOfResponse(resp)).(Output), nil
+	}
+
 	defer func() {
 		_ = resp.Body.Close()
 	}()
@@ -0,0 +1,198 @@
+package apio
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	MediaTypeJson    = "application/json"
+	MediaTypeXml     = "application/xml"
+	MediaTypeYaml    = "application/yaml"
+	MediaTypeMsgPack = "application/msgpack"
+	MediaTypeCbor    = "application/cbor"
+	MediaTypeText    = "text/plain"
+)
+
+// Codec encodes and decodes bodies of a media type
+type Codec struct {
+	MediaType string
+	Marshal   func(v any) ([]byte, error)
+	Unmarshal func(data []byte, v any) error
+	// Encode and Decode are optional, for streamed bodies whose content type
+	// has parameters, like multipart boundaries. They are used instead of
+	// Marshal and Unmarshal if set.
+	Encode func(v any) (body io.Reader, contentType string, err error)
+	Decode func(body io.Reader, contentType string, v any) error
+}
+
+// IsStreaming returns true if the codec streams bodies, i.e. has Encode and Decode
+func (c Codec) IsStreaming() bool {
+	return c.Encode != nil && c.Decode != nil
+}
+
+// codecs are initialized with the built-in ones as a variable, rather than in
+// init(), so that they are available to other package level variables
+var codecs = builtinCodecs()
+
+var JsonCodec = Codec{MediaType: MediaTypeJson, Marshal: json.Marshal, Unmarshal: json.Unmarshal}
+var XmlCodec = Codec{MediaType: MediaTypeXml, Marshal: xml.Marshal, Unmarshal: xml.Unmarshal}
+var YamlCodec = Codec{MediaType: MediaTypeYaml, Marshal: yaml.Marshal, Unmarshal: yaml.Unmarshal}
+var MsgPackCodec = Codec{MediaType: MediaTypeMsgPack, Marshal: msgpack.Marshal, Unmarshal: msgpack.Unmarshal}
+var CborCodec = Codec{MediaType: MediaTypeCbor, Marshal: cbor.Marshal, Unmarshal: cbor.Unmarshal}
+var TextCodec = Codec{MediaType: MediaTypeText, Marshal: marshalText, Unmarshal: unmarshalText}
+
+func builtinCodecs() *sync.Map {
+	result := &sync.Map{}
+	for _, codec := range []Codec{JsonCodec, XmlCodec, YamlCodec, MsgPackCodec, CborCodec, TextCodec, FormCodec, MultipartCodec, NDJsonCodec, MergePatchCodec, JsonPatchCodec} {
+		result.Store(baseMediaType(codec.MediaType), codec)
+	}
+	return result
+}
+
+// RegisterCodec makes a codec available to endpoints, replacing any codec of
+// the same media type. Parameters, like charset, are ignored.
+func RegisterCodec(codec Codec) {
+	codecs.Store(baseMediaType(codec.MediaType), codec)
+}
+
+// GetCodec returns the codec of a media type. Parameters, like charset, are ignored.
+func GetCodec(mediaType string) (Codec, bool) {
+	codec, ok := codecs.Load(baseMediaType(mediaType))
+	if !ok {
+		return Codec{}, false
+	}
+	return codec.(Codec), true
+}
+
+func mustGetCodec(mediaType string) Codec {
+	codec, ok := GetCodec(mediaType)
+	if !ok {
+		panic(fmt.Sprintf("no codec registered for media type '%s'", mediaType))
+	}
+	return codec
+}
+
+func baseMediaType(mediaType string) string {
+	parsed, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	return parsed
+}
+
+// NegotiateMediaType picks the media type to respond with, from the ones an
+// endpoint produces and an Accept header. The first produced type wins ties,
+// and an empty Accept header accepts anything.
+func NegotiateMediaType(accept string, produces []string) (string, bool) {
+	if len(produces) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return produces[0], true
+	}
+
+	type acceptRange struct {
+		mediaType string
+		q         float64
+	}
+	ranges := make([]acceptRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(qStr, 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	// most specific ranges first, so that e.g. "text/plain;q=0" overrides "*/*"
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	best, bestQ := "", 0.0
+	for _, candidate := range produces {
+		base := baseMediaType(candidate)
+		for _, r := range ranges {
+			if matchesMediaRange(base, r.mediaType) {
+				if r.q > bestQ {
+					best, bestQ = candidate, r.q
+				}
+				break
+			}
+		}
+	}
+	return best, best != ""
+}
+
+func matchesMediaRange(mediaType string, mediaRange string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	rangeType, rangeSub, _ := strings.Cut(mediaRange, "/")
+	typ, _, _ := strings.Cut(mediaType, "/")
+	return rangeSub == "*" && rangeType == typ
+}
+
+// marshalText encodes bodies implementing encoding.TextMarshaler,
+// or structs with a single string or []byte field
+func marshalText(v any) ([]byte, error) {
+	if marshaler, ok := v.(encoding.TextMarshaler); ok {
+		return marshaler.MarshalText()
+	}
+	field, err := singleTextField(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	if field.Kind() == reflect.String {
+		return []byte(field.String()), nil
+	}
+	return field.Bytes(), nil
+}
+
+func unmarshalText(data []byte, v any) error {
+	if unmarshaler, ok := v.(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText(data)
+	}
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr {
+		return fmt.Errorf("expected pointer, got %v", ptr.Kind())
+	}
+	field, err := singleTextField(ptr.Elem())
+	if err != nil {
+		return err
+	}
+	if field.Kind() == reflect.String {
+		field.SetString(string(data))
+	} else {
+		field.SetBytes(append([]byte{}, data...))
+	}
+	return nil
+}
+
+func singleTextField(value reflect.Value) (reflect.Value, error) {
+	if value.Kind() == reflect.Struct && value.NumField() == 1 {
+		field := value.Field(0)
+		if field.Kind() == reflect.String || (field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8) {
+			return field, nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("type %v can't be encoded as %s, it needs a single string or []byte field, or to implement encoding.TextMarshaler", value.Type(), MediaTypeText)
+}
@@ -0,0 +1,149 @@
+package apio
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+)
+
+type codecPath struct {
+	_ any `path:"/notes"`
+}
+
+type note struct {
+	Title string   `json:"title" xml:"title" yaml:"title" msgpack:"title" cbor:"title"`
+	Tags  []string `json:"tags" xml:"tag" yaml:"tags" msgpack:"tags" cbor:"tags"`
+}
+
+type plainNote struct {
+	Text string
+}
+
+type codecEndpointT = Endpoint[
+	EndpointInput[X, codecPath, X, note],
+	EndpointOutput[X, note],
+]
+
+var allMediaTypes = []string{MediaTypeJson, MediaTypeXml, MediaTypeYaml, MediaTypeMsgPack, MediaTypeCbor}
+
+func TestNegotiateMediaType(t *testing.T) {
+	produces := []string{MediaTypeJson, MediaTypeXml, MediaTypeText}
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", MediaTypeJson},
+		{"*/*", MediaTypeJson},
+		{"application/xml", MediaTypeXml},
+		{"text/*", MediaTypeText},
+		{"application/xml;q=0.5, text/plain", MediaTypeText},
+		{"*/*;q=0.1, application/json;q=0", MediaTypeXml},
+		{"application/cbor", ""},
+	}
+	for _, test := range tests {
+		actual, ok := NegotiateMediaType(test.accept, produces)
+		if actual != test.expected || ok != (test.expected != "") {
+			t.Fatalf("accept '%s': expected '%s', got '%s'", test.accept, test.expected, actual)
+		}
+	}
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	serverSide := codecEndpointT{
+		Method:   http.MethodPost,
+		Consumes: allMediaTypes,
+		Produces: allMediaTypes,
+	}.WithHandler(func(input EndpointInput[X, codecPath, X, note]) (EndpointOutput[X, note], error) {
+		input.Body.Tags = append(input.Body.Tags, "seen")
+		return BodyResponse(input.Body), nil
+	})
+	api := Api{Name: "codecs"}.WithEndpoints(serverSide).Validate(true)
+	server := startTestServer(t, &api)
+
+	input := NewInput(Empty, codecPath{}, Empty, note{Title: "hello", Tags: []string{"a"}})
+	for _, requestType := range allMediaTypes {
+		for _, responseType := range allMediaTypes {
+			client := codecEndpointT{
+				Method:   http.MethodPost,
+				Consumes: []string{requestType},
+				Produces: []string{responseType},
+			}
+			res, err := client.RPC(server, input, DefaultOpts())
+			if err != nil {
+				t.Fatalf("%s -> %s: failed to call RPC: %v", requestType, responseType, err)
+			}
+			if diff := cmp.Diff(note{Title: "hello", Tags: []string{"a", "seen"}}, res.Body); diff != "" {
+				t.Fatalf("%s -> %s: body mismatch:\n%s", requestType, responseType, diff)
+			}
+		}
+	}
+
+	client := codecEndpointT{Method: http.MethodPost, Produces: []string{MediaTypeText}}
+	_, err := client.RPC(server, input, DefaultOpts())
+	var errResp ErrResp
+	if !errors.As(err, &errResp) || errResp.Status != http.StatusNotAcceptable {
+		t.Fatalf("expected 406, got %v", err)
+	}
+}
+
+func TestUnsupportedContentType(t *testing.T) {
+	endpoint := codecEndpointT{
+		Method: http.MethodPost,
+	}.WithHandler(func(input EndpointInput[X, codecPath, X, note]) (EndpointOutput[X, note], error) {
+		return BodyResponse(input.Body), nil
+	})
+
+	_, err := endpoint.Handle(InputPayload{
+		Headers: map[string][]string{"Content-Type": {"application/xml"}},
+		Body:    []byte("<note><title>x</title></note>"),
+	})
+	if errResp := AsErResp(err); errResp == nil || errResp.Status != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %v", err)
+	}
+
+	res, err := endpoint.Handle(InputPayload{
+		Headers: map[string][]string{"Content-Type": {"application/json; charset=utf-8"}},
+		Body:    []byte(`{"title":"x"}`),
+	})
+	if err != nil {
+		t.Fatalf("failed to handle json with charset: %v", err)
+	}
+	if title := res.(EndpointOutput[X, note]).Body.Title; title != "x" {
+		t.Fatalf("unexpected title: %s", title)
+	}
+}
+
+func TestTextCodec(t *testing.T) {
+	bytes, err := TextCodec.Marshal(plainNote{Text: "hello"})
+	if err != nil || string(bytes) != "hello" {
+		t.Fatalf("unexpected text encoding: %s, %v", bytes, err)
+	}
+	var decoded plainNote
+	if err := TextCodec.Unmarshal([]byte("world"), &decoded); err != nil || decoded.Text != "world" {
+		t.Fatalf("unexpected text decoding: %+v, %v", decoded, err)
+	}
+	if _, err := TextCodec.Marshal(note{}); err == nil {
+		t.Fatalf("expected error encoding multi field struct as text")
+	}
+}
+
+func TestUnknownMediaTypePanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected panic for unregistered media type")
+		}
+	}()
+	codecEndpointT{Method: http.MethodPost, Produces: []string{"application/x-unknown"}}.validate(false)
+}
+
+func TestRegisterCodecWithParameters(t *testing.T) {
+	codec := TextCodec
+	codec.MediaType = "Text/X-Apio-Test; charset=utf-8"
+	RegisterCodec(codec)
+	for _, mediaType := range []string{"text/x-apio-test", "text/x-apio-test; charset=utf-8", "TEXT/X-APIO-TEST"} {
+		if found, ok := GetCodec(mediaType); !ok || found.MediaType != codec.MediaType {
+			t.Fatalf("expected the registered codec for %s", mediaType)
+		}
+	}
+}
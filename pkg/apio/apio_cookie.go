@@ -0,0 +1,121 @@
+package apio
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+var (
+	cookieType      = reflect.TypeOf(http.Cookie{})
+	cookiePtrType   = reflect.TypeOf(&http.Cookie{})
+	cookieSliceType = reflect.TypeOf([]http.Cookie{})
+)
+
+// isCookieOutputType returns true for output header field types that are
+// written as Set-Cookie headers: http.Cookie, *http.Cookie and []http.Cookie
+func isCookieOutputType(t reflect.Type) bool {
+	return t == cookieType || t == cookiePtrType || t == cookieSliceType
+}
+
+// IsSetCookie returns true for output header fields written as Set-Cookie headers
+func (a *FieldInfo) IsSetCookie() bool {
+	return isCookieOutputType(a.Type)
+}
+
+// parseRequestCookies parses the values of Cookie request headers
+func parseRequestCookies(headers map[string][]string) []*http.Cookie {
+	req := http.Request{Header: http.Header{"Cookie": headerValues(headers, "Cookie")}}
+	return req.Cookies()
+}
+
+// parseResponseCookies parses the values of Set-Cookie response headers
+func parseResponseCookies(headers map[string][]string) []*http.Cookie {
+	resp := http.Response{Header: http.Header{"Set-Cookie": headerValues(headers, "Set-Cookie")}}
+	return resp.Cookies()
+}
+
+// requestCookieHeader serializes cookies into a Cookie request header value
+func requestCookieHeader(cookies map[string]string, order []string) string {
+	parts := make([]string, 0, len(order))
+	for _, name := range order {
+		parts = append(parts, (&http.Cookie{Name: name, Value: cookies[name]}).String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// setCookieValues returns the Set-Cookie header values of an output cookie field.
+// Cookies without a name get the name of the field.
+func setCookieValues(field FieldInfo, value reflect.Value) []string {
+	toString := func(cookie http.Cookie) string {
+		if cookie.Name == "" {
+			cookie.Name = field.Name
+		}
+		return cookie.String()
+	}
+	switch field.Type {
+	case cookieType:
+		return []string{toString(value.Interface().(http.Cookie))}
+	case cookiePtrType:
+		if value.IsNil() {
+			return nil
+		}
+		return []string{toString(*value.Interface().(*http.Cookie))}
+	case cookieSliceType:
+		var result []string
+		for _, cookie := range value.Interface().([]http.Cookie) {
+			result = append(result, toString(cookie))
+		}
+		return result
+	}
+	return nil
+}
+
+// setOutputCookies assigns the cookies of Set-Cookie headers to the cookie
+// fields of an output headers struct. Named fields take the cookie with their
+// name, slice fields take the remaining ones.
+func setOutputCookies(structInfo StructInfo, target reflect.Value, hdrs map[string][]string) error {
+	cookies := parseResponseCookies(hdrs)
+	claimed := make(map[string]bool)
+
+	for _, field := range structInfo.Fields {
+		if field.Type != cookieType && field.Type != cookiePtrType {
+			continue
+		}
+		var found *http.Cookie
+		for _, cookie := range cookies {
+			if cookie.Name == field.Name {
+				found = cookie
+				break
+			}
+		}
+		if found == nil {
+			if field.IsRequired() {
+				return fmt.Errorf("required cookie not set: %s", field.Name)
+			}
+			continue
+		}
+		claimed[found.Name] = true
+		if field.IsPointer {
+			target.Field(field.Index).Set(reflect.ValueOf(found))
+		} else {
+			target.Field(field.Index).Set(reflect.ValueOf(*found))
+		}
+	}
+
+	for _, field := range structInfo.Fields {
+		if field.Type != cookieSliceType {
+			continue
+		}
+		var rest []http.Cookie
+		for _, cookie := range cookies {
+			if !claimed[cookie.Name] {
+				rest = append(rest, *cookie)
+			}
+		}
+		target.Field(field.Index).Set(reflect.ValueOf(rest))
+	}
+
+	return nil
+}
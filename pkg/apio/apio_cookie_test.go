@@ -0,0 +1,134 @@
+package apio
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"testing"
+)
+
+type loginPath struct {
+	_ any `path:"/login"`
+}
+
+type loginHeaders struct {
+	Session http.Cookie  `name:"session_id"`
+	Theme   *http.Cookie `name:"theme"`
+}
+
+type cartPath struct {
+	_ any `path:"/cart"`
+}
+
+type cartHeaders struct {
+	SessionId *int    `name:"session_id" in:"cookie"`
+	Theme     *string `name:"theme" in:"cookie"`
+}
+
+type cartBody struct {
+	SessionId *int
+	Theme     *string
+}
+
+var loginEndpoint = Endpoint[
+	EndpointInput[X, loginPath, X, X],
+	EndpointOutput[loginHeaders, X],
+]{
+	Method: http.MethodPost,
+}
+
+var cartEndpoint = Endpoint[
+	EndpointInput[cartHeaders, cartPath, X, X],
+	EndpointOutput[X, cartBody],
+]{
+	Method: http.MethodGet,
+}
+
+func TestCookieInputRoundTrip(t *testing.T) {
+	theme := "dark mode"
+	sessionId := 42
+	input := NewInput(cartHeaders{SessionId: &sessionId, Theme: &theme}, cartPath{}, Empty, Empty)
+	payload := must(input.ToPayload())
+	if cookie := payload.Headers["Cookie"]; len(cookie) != 1 || !strings.Contains(cookie[0], "session_id=42") {
+		t.Fatalf("unexpected cookie header: %v", payload.Headers)
+	}
+
+	endpoint := cartEndpoint
+	parsed := must(endpoint.parseInput(payload))
+	if *parsed.Headers.SessionId != 42 || parsed.Headers.Theme == nil || *parsed.Headers.Theme != theme {
+		t.Fatalf("unexpected parsed cookies: %+v", parsed.Headers)
+	}
+
+	_, err := endpoint.parseInput(InputPayload{Headers: map[string][]string{"Cookie": {"session_id=nope"}}})
+	if err == nil {
+		t.Fatalf("expected error for badly typed cookie")
+	}
+
+	required := Endpoint[
+		EndpointInput[struct {
+			Id int `in:"cookie"`
+		}, cartPath, X, X],
+		EndpointOutput[X, X],
+	]{}
+	_, err = required.parseInput(InputPayload{Headers: map[string][]string{"Cookie": {"Theme=x"}}})
+	if err == nil {
+		t.Fatalf("expected error for missing required cookie")
+	}
+}
+
+func TestSetCookieOutput(t *testing.T) {
+	output := EndpointOutput[loginHeaders, X]{
+		Headers: loginHeaders{
+			Session: http.Cookie{Value: "42", Path: "/", HttpOnly: true, Secure: true, SameSite: http.SameSiteStrictMode, MaxAge: 60},
+		},
+	}
+	setCookies := output.GetHeaders()["Set-Cookie"]
+	if len(setCookies) != 1 {
+		t.Fatalf("expected one Set-Cookie header, got %v", setCookies)
+	}
+	for _, attr := range []string{"session_id=42", "Path=/", "Max-Age=60", "HttpOnly", "Secure", "SameSite=Strict"} {
+		if !strings.Contains(setCookies[0], attr) {
+			t.Fatalf("expected '%s' in Set-Cookie header '%s'", attr, setCookies[0])
+		}
+	}
+
+	parsed := must(EndpointOutput[loginHeaders, X]{}.SetHeaders(map[string][]string{"Set-Cookie": setCookies})).(EndpointOutput[loginHeaders, X])
+	if parsed.Headers.Session.Value != "42" || !parsed.Headers.Session.HttpOnly || parsed.Headers.Theme != nil {
+		t.Fatalf("unexpected parsed cookies: %+v", parsed.Headers)
+	}
+
+	_, err := EndpointOutput[loginHeaders, X]{}.SetHeaders(map[string][]string{})
+	if err == nil {
+		t.Fatalf("expected error for missing required cookie")
+	}
+}
+
+func TestCookieJarRPC(t *testing.T) {
+	loginServer := loginEndpoint.WithHandler(func(input EndpointInput[X, loginPath, X, X]) (EndpointOutput[loginHeaders, X], error) {
+		return EndpointOutput[loginHeaders, X]{
+			Headers: loginHeaders{
+				Session: http.Cookie{Value: "7", Path: "/", HttpOnly: true},
+				Theme:   &http.Cookie{Name: "theme", Value: "dark", Path: "/"},
+			},
+		}, nil
+	})
+	cartServer := cartEndpoint.WithHandler(func(input EndpointInput[cartHeaders, cartPath, X, X]) (EndpointOutput[X, cartBody], error) {
+		return BodyResponse(cartBody{SessionId: input.Headers.SessionId, Theme: input.Headers.Theme}), nil
+	})
+	api := Api{Name: "cookies"}.WithEndpoints(loginServer, cartServer).Validate(true)
+	server := startTestServer(t, &api)
+
+	opts := DefaultOpts()
+	opts.Jar = must(cookiejar.New(nil))
+
+	login := must(loginEndpoint.RPC(server, NewInput(Empty, loginPath{}, Empty, Empty), opts))
+	if login.Headers.Session.Value != "7" || login.Headers.Theme == nil || login.Headers.Theme.Value != "dark" {
+		t.Fatalf("unexpected login cookies: %+v", login.Headers)
+	}
+
+	// the cookies from the jar are sent along with the (empty) cookie inputs
+	cart := must(cartEndpoint.RPC(server, NewInput(cartHeaders{}, cartPath{}, Empty, Empty), opts))
+	if cart.Body.SessionId == nil || *cart.Body.SessionId != 7 || cart.Body.Theme == nil || *cart.Body.Theme != "dark" {
+		t.Fatalf("unexpected cart: %+v", cart.Body)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -20,95 +23,266 @@ func EchoInstall(echoServer *echo.Echo, api *Api) {
 		slog.Info(fmt.Sprintf("   * %+v", s))
 	}
 
+	// echo ignores parameter names when matching, so endpoints sharing a route
+	// can have different path patterns, e.g. /users/:id and /users/:userId
+	routes := make([]string, 0)
+	pathOfRoute := make(map[string]string)
+	endpointsByRoute := make(map[string][]EndpointBase)
 	for i := range api.Endpoints {
 
 		endpoint := api.Endpoints[i] // need to do this until go 1.22 is released
 
-		path := func() string {
-			if api.IntBasePath == "" {
-				return endpoint.GetPathPattern()
-			} else {
-				return api.IntBasePath + "/" + strings.TrimPrefix(endpoint.GetPathPattern(), "/")
-			}
-		}()
+		path := echoPathOf(api, endpoint)
+		route := echoRoute(path)
+		if _, ok := endpointsByRoute[route]; !ok {
+			routes = append(routes, route)
+			pathOfRoute[route] = path
+		}
+		endpointsByRoute[route] = append(endpointsByRoute[route], endpoint)
 
 		pathWithQueryParams := path + endpoint.GetQueryPattern()
 
 		slog.Info(fmt.Sprintf(" * attaching endpoint: %s %s", endpoint.GetMethod(), pathWithQueryParams))
-		echoServer.Add(endpoint.GetMethod(), path, func(ctx echo.Context) error {
-
-			body := ctx.Request().Body
-			defer func(body io.ReadCloser) {
-				_, _ = io.ReadAll(body)
-				err := body.Close()
-				if err != nil {
-					slog.Error(fmt.Sprintf("error closing body: %v", err))
-				}
-			}(body)
+		echoServer.Add(endpoint.GetMethod(), path, echoHandler(api, endpoint))
+	}
 
-			headers := map[string][]string{}
-			for k, v := range ctx.Request().Header {
-				headers[k] = v
+	// HEAD runs GET handlers without a body, OPTIONS and other methods answer with the allowed methods
+	for _, route := range routes {
+		path := pathOfRoute[route]
+		endpoints := endpointsByRoute[route]
+		allowed := AllowedMethods(endpoints...)
+		allow := strings.Join(allowed, ", ")
+		declared := make(map[string]bool)
+		for _, endpoint := range endpoints {
+			declared[endpoint.GetMethod()] = true
+		}
+		if !declared[http.MethodHead] {
+			if i := slices.IndexFunc(endpoints, answersHead); i >= 0 {
+				echoServer.Add(http.MethodHead, echoPathOf(api, endpoints[i]), echoHandler(api, endpoints[i]))
+				declared[http.MethodHead] = true
 			}
-
-			pathParams := map[string]string{}
-			pathNames := ctx.ParamNames()
-			pathValues := ctx.ParamValues()
-			numIncParams := len(ctx.ParamNames())
-			for i := 0; i < numIncParams; i++ {
-				pathParams[pathNames[i]] = pathValues[i]
+		}
+		if !declared[http.MethodOptions] {
+			echoServer.Add(http.MethodOptions, path, func(ctx echo.Context) error {
+				ctx.Response().Header().Set(echo.HeaderAllow, allow)
+				return ctx.NoContent(http.StatusNoContent)
+			})
+		}
+		for _, method := range standardMethods {
+			if declared[method] || method == http.MethodOptions {
+				continue
 			}
+			echoServer.Add(method, path, func(ctx echo.Context) error {
+				ctx.Response().Header().Set(echo.HeaderAllow, allow)
+				return ctx.String(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed, allowed methods: %s", ctx.Request().Method, allow))
+			})
+		}
+	}
+}
 
-			queryParams := map[string][]string{}
-			for k, v := range ctx.QueryParams() {
-				queryParams[k] = v
-			}
+// echoPathOf returns the path an endpoint is installed at
+func echoPathOf(api *Api, endpoint EndpointBase) string {
+	if api.IntBasePath == "" {
+		return endpoint.GetPathPattern()
+	}
+	return api.IntBasePath + "/" + strings.TrimPrefix(endpoint.GetPathPattern(), "/")
+}
+
+// echoRoute returns the route echo matches a path as, i.e. without parameter names
+func echoRoute(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// answersHead returns true for GET endpoints that HEAD requests can be
+// answered by, i.e. all but WebSockets and event streams
+func answersHead(endpoint EndpointBase) bool {
+	if endpoint.GetMethod() != http.MethodGet {
+		return false
+	}
+	if _, isEventStream := endpoint.(EventStreamEndpoint); isEventStream {
+		return false
+	}
+	if _, isWebSocket := endpoint.(WebSocketEndpoint); isWebSocket {
+		return false
+	}
+	handler, _ := endpoint.GetOutput().GetHandler()
+	_, isUpgrade := handler.(WebSocketUpgrade)
+	return !isUpgrade
+}
+
+// standardMethods are the methods of RFC 9110 and PATCH, in the order they are listed in Allow headers
+var standardMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// AllowedMethods returns the methods to list in the Allow header of a path,
+// given the endpoints sharing it: their methods, HEAD if any of them is a GET
+// that HEAD requests can be answered by, and OPTIONS
+func AllowedMethods(endpoints ...EndpointBase) []string {
+	allowed := map[string]bool{http.MethodOptions: true}
+	for _, endpoint := range endpoints {
+		allowed[endpoint.GetMethod()] = true
+		if answersHead(endpoint) {
+			allowed[http.MethodHead] = true
+		}
+	}
+	result := make([]string, 0, len(allowed))
+	for _, method := range standardMethods {
+		if allowed[method] {
+			result = append(result, method)
+			delete(allowed, method)
+		}
+	}
+	others := make([]string, 0, len(allowed))
+	for method := range allowed {
+		others = append(others, method)
+	}
+	sort.Strings(others)
+	return append(result, others...)
+}
+
+// echoHandler handles requests of an endpoint
+func echoHandler(api *Api, endpoint EndpointBase) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
 
-			bodyBytes, err := io.ReadAll(body)
+		body := ctx.Request().Body
+		defer func(body io.ReadCloser) {
+			_, _ = io.ReadAll(body)
+			err := body.Close()
 			if err != nil {
+				slog.Error(fmt.Sprintf("error closing body: %v", err))
+			}
+		}(body)
+
+		headers := map[string][]string{}
+		for k, v := range ctx.Request().Header {
+			headers[k] = v
+		}
+
+		pathParams := map[string]string{}
+		pathNames := ctx.ParamNames()
+		pathValues := ctx.ParamValues()
+		numIncParams := len(ctx.ParamNames())
+		for i := 0; i < numIncParams; i++ {
+			pathParams[pathNames[i]] = pathValues[i]
+		}
+
+		queryParams := map[string][]string{}
+		for k, v := range ctx.QueryParams() {
+			queryParams[k] = v
+		}
+
+		outputBodyInfo := endpoint.GetBodyOutputInfo()
+		responseMediaType, ok := NegotiateMediaType(ctx.Request().Header.Get("Accept"), endpoint.GetProduces())
+		if !ok && outputBodyInfo.HasContent() {
+			return ctx.String(http.StatusNotAcceptable, fmt.Sprintf("not acceptable, available media types: %v", endpoint.GetProduces()))
+		}
+
+		var bodyReader io.Reader = body
+		if maxBodyBytes := endpoint.GetMaxBodyBytes(); maxBodyBytes > 0 {
+			bodyReader = http.MaxBytesReader(ctx.Response(), body, maxBodyBytes)
+		}
+
+		// streaming codecs read the body in the handler, others get it all up front
+		var bodyBytes []byte
+		var streamedBody io.Reader
+		if isStreamingRequest(endpoint, ctx.Request().Header.Get("Content-Type")) {
+			streamedBody = bodyReader
+		} else {
+			var err error
+			bodyBytes, err = io.ReadAll(bodyReader)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return ctx.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body larger than %d bytes", maxBytesErr.Limit))
+			} else if err != nil {
 				return fmt.Errorf("error reading body: %v", err)
 			}
+		}
 
-			result, err := endpoint.Handle(InputPayload{
-				Headers: headers,
-				Path:    pathParams,
-				Query:   queryParams,
-				Body:    bodyBytes,
-			})
+		result, err := api.Handle(endpoint, InputPayload{
+			Headers:    headers,
+			Path:       pathParams,
+			PathStr:    strings.TrimPrefix(ctx.Request().URL.EscapedPath(), api.IntBasePath),
+			Query:      queryParams,
+			Body:       bodyBytes,
+			BodyReader: streamedBody,
+		})
 
-			if err != nil {
-				var errResp *ErrResp
-				if errors.As(err, &errResp) {
-					if errResp.Status/100 == 4 {
-						slog.Warn(fmt.Sprintf("error response: %v", errResp))
-					} else {
-						slog.Error(fmt.Sprintf("error response: %v", errResp))
-					}
-					return ctx.String(errResp.Status, errResp.ClMsg)
+		if err != nil {
+			var errResp *ErrResp
+			if errors.As(err, &errResp) {
+				if errResp.Status/100 == 4 {
+					slog.Warn(fmt.Sprintf("error response: %v", errResp))
 				} else {
-					slog.Error(fmt.Sprintf("error: %v", err))
-					return ctx.String(http.StatusInternalServerError, fmt.Sprintf("internal error, see server logs"))
+					slog.Error(fmt.Sprintf("error response: %v", errResp))
 				}
-			}
-
-			outputBodyBytes, err := result.GetBody()
-			if err != nil {
-				slog.Error(fmt.Sprintf("error getting body: %v", err))
+				return ctx.String(errResp.Status, errResp.ClMsg)
+			} else {
+				slog.Error(fmt.Sprintf("error: %v", err))
 				return ctx.String(http.StatusInternalServerError, fmt.Sprintf("internal error, see server logs"))
 			}
+		}
 
-			// write headers
-			for k, vs := range result.GetHeaders() {
-				for _, v := range vs {
-					ctx.Response().Header().Add(k, v)
-				}
+		// write headers
+		outputHeaders, err := result.EncodeHeaders()
+		if err != nil {
+			slog.Error(fmt.Sprintf("error encoding headers: %v", err))
+			return ctx.String(http.StatusInternalServerError, fmt.Sprintf("internal error, see server logs"))
+		}
+		for k, vs := range outputHeaders {
+			for _, v := range vs {
+				ctx.Response().Header().Add(k, v)
 			}
+		}
 
-			if len(outputBodyBytes) == 0 {
-				return ctx.NoContent(http.StatusNoContent)
-			} else {
-				return ctx.JSONBlob(http.StatusOK, outputBodyBytes)
-			}
-		})
+		// streams and websocket upgrades write the response themselves
+		if handler, ok := result.GetHandler(); ok {
+			handler.ServeHTTP(ctx.Response(), ctx.Request())
+			return nil
+		}
+
+		outputBodyBytes, err := result.GetBodyAs(mustGetCodec(responseMediaType))
+		if err != nil {
+			slog.Error(fmt.Sprintf("error getting body: %v", err))
+			return ctx.String(http.StatusInternalServerError, fmt.Sprintf("internal error, see server logs"))
+		}
+
+		if len(outputBodyBytes) == 0 {
+			return ctx.NoContent(http.StatusNoContent)
+		} else if ctx.Request().Method == http.MethodHead {
+			ctx.Response().Header().Set(echo.HeaderContentType, responseMediaType)
+			ctx.Response().Header().Set(echo.HeaderContentLength, strconv.Itoa(len(outputBodyBytes)))
+			return ctx.NoContent(http.StatusOK)
+		} else {
+			return ctx.Blob(http.StatusOK, responseMediaType, outputBodyBytes)
+		}
+	}
+}
+
+// isStreamingRequest returns true if the request body is consumed by the endpoint with a streaming codec
+func isStreamingRequest(endpoint EndpointBase, contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	for _, mediaType := range endpoint.GetConsumes() {
+		if baseMediaType(mediaType) == baseMediaType(contentType) {
+			codec, ok := GetCodec(mediaType)
+			return ok && codec.IsStreaming()
+		}
 	}
+	return false
 }
@@ -0,0 +1,154 @@
+package apio
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func doRequest(t *testing.T, method string, url string) (*http.Response, string) {
+	req, _ := http.NewRequest(method, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make %s request: %v", method, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	return resp, string(body)
+}
+
+func TestAutomaticMethods(t *testing.T) {
+	api := Api{Name: "methods"}.WithEndpoints(pageEndpoint, importEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+	url := requestUrl(server, InputPayload{PathStr: "/records"}) + "?PageSize=10"
+
+	do := func(method string) (*http.Response, string) {
+		return doRequest(t, method, url)
+	}
+
+	getResp, getBody := do(http.MethodGet)
+	headResp, headBody := do(http.MethodHead)
+	if headResp.StatusCode != http.StatusOK || headBody != "" {
+		t.Fatalf("expected an empty 200 response to HEAD, got %d: %s", headResp.StatusCode, headBody)
+	}
+	if headResp.Header.Get("Content-Type") != getResp.Header.Get("Content-Type") {
+		t.Fatalf("expected the GET content type %s, got %s", getResp.Header.Get("Content-Type"), headResp.Header.Get("Content-Type"))
+	}
+	if headResp.Header.Get("Content-Length") != strconv.Itoa(len(getBody)) {
+		t.Fatalf("expected content length %d, got %s", len(getBody), headResp.Header.Get("Content-Length"))
+	}
+
+	expectedAllow := "GET, HEAD, POST, OPTIONS"
+	optionsResp, _ := do(http.MethodOptions)
+	if optionsResp.StatusCode != http.StatusNoContent || optionsResp.Header.Get("Allow") != expectedAllow {
+		t.Fatalf("expected 204 with Allow %s, got %d with %s", expectedAllow, optionsResp.StatusCode, optionsResp.Header.Get("Allow"))
+	}
+
+	for _, method := range []string{http.MethodDelete, http.MethodPut, http.MethodPatch} {
+		resp, _ := do(method)
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != expectedAllow {
+			t.Fatalf("expected 405 with Allow %s for %s, got %d with %s", expectedAllow, method, resp.StatusCode, resp.Header.Get("Allow"))
+		}
+	}
+}
+
+func TestAllowedMethods(t *testing.T) {
+	custom := importEndpoint
+	custom.Method = "PROPFIND"
+	head := pageEndpoint
+	head.Method = http.MethodHead
+	for expected, endpoints := range map[string][]EndpointBase{
+		"GET, HEAD, POST, OPTIONS": {importEndpoint, pageEndpoint},
+		"HEAD, OPTIONS, PROPFIND":  {custom, head},
+		"OPTIONS":                  {},
+	} {
+		if actual := strings.Join(AllowedMethods(endpoints...), ", "); actual != expected {
+			t.Fatalf("expected allowed methods %s, got %s", expected, actual)
+		}
+	}
+}
+
+type memberPath struct {
+	_  any `path:"/members"`
+	Id int `name:"id"`
+}
+
+type memberByUserIdPath struct {
+	_    any `path:"/members"`
+	User int `name:"userId"`
+}
+
+type member struct {
+	Id int
+}
+
+func TestAutomaticMethodsIgnoreParameterNames(t *testing.T) {
+	getMember := Endpoint[EndpointInput[X, memberPath, X, X], EndpointOutput[X, member]]{
+		Method: http.MethodGet,
+		Handler: func(input EndpointInput[X, memberPath, X, X]) (EndpointOutput[X, member], error) {
+			return BodyResponse(member{Id: input.Path.Id}), nil
+		},
+	}
+	deleted := 0
+	deleteMember := Endpoint[EndpointInput[X, memberByUserIdPath, X, X], EndpointOutput[X, X]]{
+		Method: http.MethodDelete,
+		Handler: func(input EndpointInput[X, memberByUserIdPath, X, X]) (EndpointOutput[X, X], error) {
+			deleted = input.Path.User
+			return EmptyResponse(), nil
+		},
+	}
+	api := Api{Name: "members"}.WithEndpoints(getMember, deleteMember).Validate(true)
+	server := startTestServer(t, &api)
+	url := requestUrl(server, InputPayload{PathStr: "/members/7"})
+
+	if resp, body := doRequest(t, http.MethodGet, url); resp.StatusCode != http.StatusOK || !strings.Contains(body, "7") {
+		t.Fatalf("expected GET to be handled, got %d: %s", resp.StatusCode, body)
+	}
+	if resp, body := doRequest(t, http.MethodDelete, url); resp.StatusCode/100 != 2 || deleted != 7 {
+		t.Fatalf("expected DELETE to be handled, got %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := doRequest(t, http.MethodHead, url); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected HEAD to be handled, got %d", resp.StatusCode)
+	}
+
+	expectedAllow := "GET, HEAD, DELETE, OPTIONS"
+	if resp, _ := doRequest(t, http.MethodOptions, url); resp.StatusCode != http.StatusNoContent || resp.Header.Get("Allow") != expectedAllow {
+		t.Fatalf("expected 204 with Allow %s, got %d with %s", expectedAllow, resp.StatusCode, resp.Header.Get("Allow"))
+	}
+	if resp, _ := doRequest(t, http.MethodPut, url); resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != expectedAllow {
+		t.Fatalf("expected 405 with Allow %s, got %d with %s", expectedAllow, resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
+
+func TestNoAutomaticHeadForSelfWritingEndpoints(t *testing.T) {
+	api := Api{Name: "streams"}.WithEndpoints(
+		chatEndpoint.WithSocketHandler(echoChat),
+		ticksEndpoint.WithEventHandler(sendTicks),
+	).Validate(true)
+	server := startTestServer(t, &api)
+
+	for _, path := range []string{"/rooms/a/chat", "/ticks"} {
+		resp, body := doRequest(t, http.MethodHead, requestUrl(server, InputPayload{PathStr: path}))
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, OPTIONS" {
+			t.Fatalf("%s: expected 405 with Allow GET, OPTIONS, got %d with %s: %s", path, resp.StatusCode, resp.Header.Get("Allow"), body)
+		}
+	}
+}
+
+func TestAutomaticHeadForStreamDownloads(t *testing.T) {
+	endpoint := downloadEndpointT{Method: http.MethodGet}
+	api := Api{Name: "downloads"}.WithEndpoints(endpoint.WithHandler(func(input EndpointInput[downloadHeaders, downloadPath, X, X]) (EndpointOutput[X, Stream], error) {
+		return BodyResponse(NewStream("text/plain", int64(len(downloadContent)), strings.NewReader(downloadContent))), nil
+	})).Validate(true)
+	server := startTestServer(t, &api)
+
+	resp, body := doRequest(t, http.MethodHead, requestUrl(server, InputPayload{PathStr: "/files/report.txt"}))
+	if resp.StatusCode != http.StatusOK || body != "" {
+		t.Fatalf("expected 200 without body, got %d: %s", resp.StatusCode, body)
+	}
+	if length := resp.Header.Get("Content-Length"); length != strconv.Itoa(len(downloadContent)) {
+		t.Errorf("expected Content-Length %d, got %q", len(downloadContent), length)
+	}
+}
@@ -0,0 +1,354 @@
+package apio
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MediaTypeForm = "application/x-www-form-urlencoded"
+
+// FormCodec encodes struct bodies as form data. Fields are named like query
+// parameters (field name or `name:` tag). Nested structs use bracket keys,
+// e.g. "address[city]", slices of values repeat the key, slices of structs
+// are indexed, e.g. "items[0][sku]", and maps with string keys are keyed,
+// e.g. "labels[env]".
+var FormCodec = Codec{MediaType: MediaTypeForm, Marshal: marshalForm, Unmarshal: unmarshalForm}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// serializeUrlValue formats a value for use in a path, query or form
+func serializeUrlValue(value reflect.Value) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // e.g. for "<" in Link headers
+	if err := encoder.Encode(value.Interface()); err != nil {
+		return "", fmt.Errorf("failed to marshal url value '%s': %w", value, err)
+	}
+	str := strings.TrimSuffix(buf.String(), "\n")
+	return strings.TrimSuffix(strings.TrimPrefix(str, "\""), "\""), nil
+}
+
+// isFormScalar returns true for types that are encoded as a single form value
+func isFormScalar(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) || reflect.PointerTo(t).Implements(textUnmarshalerType) || isOptionalType(t) {
+		return true
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return true // []byte, base64 like in json
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+		return false
+	default:
+		return true
+	}
+}
+
+// isDeepObject returns true for types that are encoded as deepObject query
+// parameters, i.e. structs and maps with string keys, e.g. "filter[status]"
+func isDeepObject(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isFormScalar(t) {
+		return false
+	}
+	return t.Kind() == reflect.Struct || (t.Kind() == reflect.Map && t.Key().Kind() == reflect.String)
+}
+
+// IsDeepObject returns true for query fields encoded in deepObject style
+func (a *FieldInfo) IsDeepObject() bool {
+	return isDeepObject(a.Type)
+}
+
+// deepObjectValues adds bracketed keys for dotted ones, e.g. "filter[status]"
+// for "filter.status", so that both styles decode like form keys
+func deepObjectValues(query map[string][]string) url.Values {
+	result := url.Values{}
+	for key, values := range query {
+		result[key] = append(result[key], values...)
+		if !strings.Contains(key, ".") || strings.Contains(key, "[") {
+			continue
+		}
+		parts := strings.Split(key, ".")
+		bracketed := parts[0]
+		for _, part := range parts[1:] {
+			bracketed = formKey(bracketed, part)
+		}
+		result[bracketed] = append(result[bracketed], values...)
+	}
+	return result
+}
+
+func formFields(t reflect.Type) ([]FieldInfo, error) {
+	info, err := GetStructInfoOfType(t)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FieldInfo, 0, len(info.Fields))
+	for _, field := range info.Fields {
+		if field.HasName() && field.StructField.IsExported() {
+			result = append(result, field)
+		}
+	}
+	return result, nil
+}
+
+func marshalForm(v any) ([]byte, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("form bodies must be structs, got %v", value.Type())
+	}
+	form := url.Values{}
+	if err := encodeFormStruct(form, "", value); err != nil {
+		return nil, err
+	}
+	return []byte(form.Encode()), nil
+}
+
+func formKey(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "[" + name + "]"
+}
+
+func encodeFormStruct(form url.Values, prefix string, value reflect.Value) error {
+	fields, err := formFields(value.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if err := encodeFormValue(form, formKey(prefix, field.Name), value.Field(field.Index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeFormValue(form url.Values, key string, value reflect.Value) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if isUnsetOptional(value) {
+		return nil
+	}
+	switch {
+	case value.Kind() == reflect.String:
+		// form values are sent as is, e.g. by browsers, so strings aren't json escaped
+		form.Add(key, value.String())
+	case isFormScalar(value.Type()):
+		str, err := serializeUrlValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode form field '%s': %w", key, err)
+		}
+		form.Add(key, str)
+	case value.Kind() == reflect.Struct:
+		return encodeFormStruct(form, key, value)
+	case value.Kind() == reflect.Slice && isFormScalar(value.Type().Elem()):
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeFormValue(form, key, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case value.Kind() == reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeFormValue(form, formKey(key, strconv.Itoa(i)), value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String:
+		for _, mapKey := range value.MapKeys() {
+			if err := encodeFormValue(form, formKey(key, mapKey.String()), value.MapIndex(mapKey)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported form field type %v for '%s'", value.Type(), key)
+	}
+	return nil
+}
+
+func unmarshalForm(data []byte, v any) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("form bodies must be decoded into struct pointers, got %T", v)
+	}
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return fmt.Errorf("failed to parse form: %w", err)
+	}
+	return decodeFormStruct(form, "", ptr.Elem())
+}
+
+func decodeFormStruct(form url.Values, prefix string, target reflect.Value) error {
+	fields, err := formFields(target.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if isFileField(field.Type) {
+			continue // only in multipart bodies
+		}
+		key := formKey(prefix, field.Name)
+		fieldValue := target.Field(field.Index)
+		if !hasFormKey(form, key) {
+			if field.IsRequired() && isFormScalar(field.Type) {
+				return fmt.Errorf("missing required form field '%s'", key)
+			}
+			continue
+		}
+		if field.IsPointer {
+			fieldValue.Set(reflect.New(field.ValueType))
+			fieldValue = fieldValue.Elem()
+		}
+		if err := decodeFormValue(form, key, fieldValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeFormValue(form url.Values, key string, target reflect.Value) error {
+	t := target.Type()
+	switch {
+	case isFormScalar(t):
+		return setFormScalar(key, form.Get(key), target)
+	case t.Kind() == reflect.Struct:
+		return decodeFormStruct(form, key, target)
+	case t.Kind() == reflect.Slice && isFormScalar(t.Elem()):
+		values := append(form[key], form[key+"[]"]...)
+		result := reflect.MakeSlice(t, len(values), len(values))
+		for i, str := range values {
+			if err := setFormScalar(key, str, result.Index(i)); err != nil {
+				return err
+			}
+		}
+		target.Set(result)
+	case t.Kind() == reflect.Slice:
+		indices := formIndices(form, key)
+		result := reflect.MakeSlice(t, len(indices), len(indices))
+		for i, index := range indices {
+			elem := result.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				elem.Set(reflect.New(t.Elem().Elem()))
+				elem = elem.Elem()
+			}
+			if err := decodeFormValue(form, formKey(key, strconv.Itoa(index)), elem); err != nil {
+				return err
+			}
+		}
+		target.Set(result)
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		result := reflect.MakeMap(t)
+		for _, mapKey := range formMapKeys(form, key) {
+			elem := reflect.New(t.Elem()).Elem()
+			value := elem
+			if value.Kind() == reflect.Ptr {
+				value.Set(reflect.New(t.Elem().Elem()))
+				value = value.Elem()
+			}
+			if err := decodeFormValue(form, formKey(key, mapKey), value); err != nil {
+				return err
+			}
+			result.SetMapIndex(reflect.ValueOf(mapKey).Convert(t.Key()), elem)
+		}
+		target.Set(result)
+	default:
+		return fmt.Errorf("unsupported form field type %v for '%s'", t, key)
+	}
+	return nil
+}
+
+func setFormScalar(key string, str string, target reflect.Value) error {
+	if target.Kind() == reflect.Ptr {
+		ptr := reflect.New(target.Type().Elem())
+		if err := setFormScalar(key, str, ptr.Elem()); err != nil {
+			return err
+		}
+		target.Set(ptr)
+		return nil
+	}
+	if target.Kind() == reflect.String {
+		target.SetString(str)
+		return nil
+	}
+	parseFn, err := getStringParsePtrFn(target.Type())
+	if err != nil {
+		return fmt.Errorf("failed to get parser for form field '%s': %w", key, err)
+	}
+	parsedPtr, err := parseFn(str)
+	if err != nil {
+		return fmt.Errorf("failed to parse form field '%s': %w", key, err)
+	}
+	target.Set(reflect.ValueOf(parsedPtr).Elem())
+	return nil
+}
+
+// hasFormKey returns true if the form has the key, or keys nested under it
+func hasFormKey(form url.Values, key string) bool {
+	if _, ok := form[key]; ok {
+		return true
+	}
+	for k := range form {
+		if strings.HasPrefix(k, key+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// formIndices returns the sorted indices of keys like "key[3]..."
+func formIndices(form url.Values, key string) []int {
+	seen := make(map[int]bool)
+	for k := range form {
+		rest, ok := strings.CutPrefix(k, key+"[")
+		if !ok {
+			continue
+		}
+		indexStr, _, ok := strings.Cut(rest, "]")
+		if !ok {
+			continue
+		}
+		if index, err := strconv.Atoi(indexStr); err == nil {
+			seen[index] = true
+		}
+	}
+	result := make([]int, 0, len(seen))
+	for index := range seen {
+		result = append(result, index)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// formMapKeys returns the sorted keys of keys like "key[env]..."
+func formMapKeys(form url.Values, key string) []string {
+	seen := make(map[string]bool)
+	for k := range form {
+		rest, ok := strings.CutPrefix(k, key+"[")
+		if !ok {
+			continue
+		}
+		if mapKey, _, ok := strings.Cut(rest, "]"); ok {
+			seen[mapKey] = true
+		}
+	}
+	result := make([]string, 0, len(seen))
+	for mapKey := range seen {
+		result = append(result, mapKey)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,113 @@
+package apio
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type formAddress struct {
+	City string
+	Zip  *int
+}
+
+type formItem struct {
+	Sku string `name:"sku"`
+	Qty int    `name:"qty"`
+}
+
+type formOrder struct {
+	Customer string   `name:"customer"`
+	Note     *string  `name:"note"`
+	Tags     []string `name:"tag"`
+	Address  formAddress
+	Items    []formItem `name:"items"`
+	Express  bool
+}
+
+type tokenPath struct {
+	_ any `path:"/token"`
+}
+
+type tokenRequest struct {
+	GrantType string  `name:"grant_type"`
+	Scope     *string `name:"scope"`
+}
+
+type tokenResponse struct {
+	AccessToken string
+}
+
+func TestFormRoundTrip(t *testing.T) {
+	zip := 12345
+	note := `say "hi" & bye`
+	order := formOrder{
+		Customer: "alice",
+		Note:     &note,
+		Tags:     []string{"a", "b"},
+		Address:  formAddress{City: "Stockholm", Zip: &zip},
+		Items:    []formItem{{Sku: "x1", Qty: 2}, {Sku: "y2", Qty: 1}},
+		Express:  true,
+	}
+
+	encoded, err := FormCodec.Marshal(order)
+	if err != nil {
+		t.Fatalf("failed to encode form: %v", err)
+	}
+	form, _ := url.ParseQuery(string(encoded))
+	expectedForm := url.Values{
+		"customer":      {"alice"},
+		"note":          {note},
+		"tag":           {"a", "b"},
+		"Address[City]": {"Stockholm"},
+		"Address[Zip]":  {"12345"},
+		"items[0][sku]": {"x1"},
+		"items[0][qty]": {"2"},
+		"items[1][sku]": {"y2"},
+		"items[1][qty]": {"1"},
+		"Express":       {"true"},
+	}
+	if diff := cmp.Diff(expectedForm, form); diff != "" {
+		t.Fatalf("form mismatch:\n%s", diff)
+	}
+
+	var decoded formOrder
+	if err := FormCodec.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("failed to decode form: %v", err)
+	}
+	if diff := cmp.Diff(order, decoded); diff != "" {
+		t.Fatalf("decoded mismatch:\n%s", diff)
+	}
+
+	if err := FormCodec.Unmarshal([]byte("note=x"), &decoded); err == nil {
+		t.Fatalf("expected error for missing required form field")
+	}
+}
+
+func TestFormRPC(t *testing.T) {
+	endpoint := Endpoint[
+		EndpointInput[X, tokenPath, X, tokenRequest],
+		EndpointOutput[X, tokenResponse],
+	]{
+		Method:   http.MethodPost,
+		Consumes: []string{MediaTypeForm},
+	}
+	serverSide := endpoint.WithHandler(func(input EndpointInput[X, tokenPath, X, tokenRequest]) (EndpointOutput[X, tokenResponse], error) {
+		if input.Body.GrantType != "client_credentials" || input.Body.Scope == nil {
+			return EndpointOutput[X, tokenResponse]{}, NewError(http.StatusBadRequest, "bad grant", nil)
+		}
+		return BodyResponse(tokenResponse{AccessToken: "token-for:" + *input.Body.Scope}), nil
+	})
+	api := Api{Name: "forms"}.WithEndpoints(serverSide).Validate(true)
+	server := startTestServer(t, &api)
+
+	scope := "read write"
+	res, err := endpoint.RPC(server, NewInput(Empty, tokenPath{}, Empty, tokenRequest{GrantType: "client_credentials", Scope: &scope}), DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call form RPC: %v", err)
+	}
+	if res.Body.AccessToken != "token-for:read write" {
+		t.Fatalf("unexpected token: %s", res.Body.AccessToken)
+	}
+}
@@ -0,0 +1,93 @@
+package apio
+
+import (
+	"reflect"
+	"strings"
+)
+
+// isHeaderSlice returns true for header fields bound to repeated headers
+func isHeaderSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && !isFormScalar(t)
+}
+
+// IsHeaderList returns true for header fields holding a list of values, sent
+// as repeated headers and optional like pointer fields
+func (a *FieldInfo) IsHeaderList() bool {
+	return isHeaderSlice(a.Type)
+}
+
+// splitHeaderList splits the lines of a list header into its elements, per
+// the list syntax of RFC 9110: elements are separated by commas, may be
+// quoted strings, and empty elements are ignored
+func splitHeaderList(lines []string) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		var element strings.Builder
+		quoted, inQuotes, escaped := false, false, false
+		flush := func() {
+			str := element.String()
+			if !quoted {
+				str = strings.TrimSpace(str)
+			}
+			if str != "" || quoted {
+				result = append(result, str)
+			}
+			element.Reset()
+			quoted = false
+		}
+		for _, c := range line {
+			switch {
+			case escaped:
+				element.WriteRune(c)
+				escaped = false
+			case inQuotes && c == '\\':
+				escaped = true
+			case c == '"':
+				if !inQuotes && strings.TrimSpace(element.String()) == "" {
+					element.Reset()
+				}
+				inQuotes = !inQuotes
+				quoted = true
+			case inQuotes:
+				element.WriteRune(c)
+			case c == ',':
+				flush()
+			case quoted && (c == ' ' || c == '\t'):
+				// whitespace after a quoted string
+			default:
+				element.WriteRune(c)
+			}
+		}
+		flush()
+	}
+	return result
+}
+
+// quoteHeaderListElement quotes list elements that would otherwise be split
+func quoteHeaderListElement(element string) string {
+	if !strings.ContainsAny(element, ",\"") && strings.TrimSpace(element) == element {
+		return element
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(element) + `"`
+}
+
+// headerListValues serializes the elements of a slice header field, one
+// header line each
+func headerListValues(value reflect.Value) ([]string, error) {
+	result := make([]string, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		elem := value.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+		str, err := serializeUrlValue(elem)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, quoteHeaderListElement(str))
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package apio
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type listHeaders struct {
+	Tags  []string `name:"X-Tags"`
+	Ids   []int    `name:"X-Ids"`
+	Trace *string  `name:"X-Trace"`
+}
+
+type listInput = EndpointInput[listHeaders, recordsPath, X, X]
+type listOutput = EndpointOutput[X, listHeaders]
+
+var listEndpoint = Endpoint[listInput, listOutput]{
+	Method: http.MethodGet,
+	Handler: func(input listInput) (listOutput, error) {
+		return BodyResponse(input.Headers), nil
+	},
+}
+
+func TestSplitHeaderList(t *testing.T) {
+	for line, expected := range map[string][]string{
+		"a, b,c":                {"a", "b", "c"},
+		"a,,  ,b":               {"a", "b"},
+		`"a,b", "say \"hi\""`:   {"a,b", `say "hi"`},
+		`"", x`:                 {"", "x"},
+		"":                      {},
+		` "quoted" , unquoted `: {"quoted", "unquoted"},
+	} {
+		if diff := cmp.Diff(expected, splitHeaderList([]string{line})); diff != "" {
+			t.Fatalf("unexpected elements of %s (-want +got):\n%s", line, diff)
+		}
+	}
+}
+
+func TestListHeaders(t *testing.T) {
+	api := Api{Name: "headers"}.WithEndpoints(listEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	client := listEndpoint
+	client.Handler = nil
+	trace := "abc"
+	for _, headers := range []listHeaders{
+		{Tags: []string{"a", "b,c", ` say "hi"`}, Ids: []int{1, 2, 3}, Trace: &trace},
+		{Ids: []int{7}},
+		{},
+	} {
+		output, err := client.RPC(server, NewInput(headers, recordsPath{}, Empty, Empty), DefaultOpts())
+		if err != nil {
+			t.Fatalf("failed to call endpoint: %v", err)
+		}
+		if diff := cmp.Diff(headers, output.Body); diff != "" {
+			t.Fatalf("unexpected headers (-want +got):\n%s", diff)
+		}
+	}
+
+	for _, test := range []struct {
+		headers  http.Header
+		status   int
+		expected string
+	}{
+		{http.Header{"X-Ids": {"1, 2", "3"}, "X-Tags": {"a"}}, http.StatusOK, `{"Tags":["a"],"Ids":[1,2,3],"Trace":null}`},
+		{http.Header{"X-Tags": {`"a,b", c`}}, http.StatusOK, `{"Tags":["a,b","c"],"Ids":null,"Trace":null}`},
+		{http.Header{"X-Ids": {"1,x"}}, http.StatusBadRequest, ""},
+		{http.Header{"X-Trace": {"a", "b"}}, http.StatusBadRequest, ""},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, requestUrl(server, InputPayload{PathStr: "/records"}), nil)
+		req.Header = test.headers
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Fatalf("expected status %d for %v, got %d", test.status, test.headers, resp.StatusCode)
+		}
+		if test.expected != "" {
+			if diff := cmp.Diff(test.expected, string(body)); diff != "" {
+				t.Fatalf("unexpected headers for %v (-want +got):\n%s", test.headers, diff)
+			}
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package apio
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -11,10 +12,22 @@ import (
 
 type InputPayload struct {
 	Headers map[string][]string
+	// Path holds the path parameters by name, and the rest of the path of
+	// catch-all fields as "*"
 	Path    map[string]string
 	PathStr string
 	Query   map[string][]string
 	Body    []byte
+	// BodyReader streams the body instead of Body, for streaming codecs like multipart
+	BodyReader io.Reader
+}
+
+// bodyReader returns the BodyReader, or a reader of Body if not set
+func (p InputPayload) bodyReader() io.Reader {
+	if p.BodyReader != nil {
+		return p.BodyReader
+	}
+	return bytes.NewReader(p.Body)
 }
 
 func (p InputPayload) QueryString() string {
@@ -37,17 +50,20 @@ type EndpointInputBase interface {
 	getPath() any
 	calcHeaderBindings() HeaderBindings
 	calcPathBindings() PathBindings
-	calcQueryBindings() QueryBindings
+	calcQueryBindings(naming NamingPolicy) QueryBindings
 	validateBodyType()
 	getQuery() any
 	getBody() any
 	parse(
 		payload InputPayload,
+		codec Codec,
 		bindings HeaderBindings,
 		pathBinding PathBindings,
 		queryBindings QueryBindings,
 	) (any, error)
 	ToPayload() (InputPayload, error)
+	ToPayloadAs(codec Codec) (InputPayload, error)
+	toPayload(codec Codec, queryNaming NamingPolicy) (InputPayload, error)
 	GetHeaderInfo() StructInfo
 	GetPathInfo() StructInfo
 	GetQueryInfo() StructInfo
@@ -95,23 +111,37 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) getHeaders()
 	return e.Headers
 }
 
+// ToPayload converts the input to a payload, with a JSON body. Query
+// parameters are named by field, see Endpoint.ToPayload to apply a QueryNaming.
 func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) ToPayload() (InputPayload, error) {
+	return e.ToPayloadAs(JsonCodec)
+}
+
+// ToPayloadAs converts the input to a payload, with the body encoded by the codec
+func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) ToPayloadAs(codec Codec) (InputPayload, error) {
+	return e.toPayload(codec, nil)
+}
 
-	bodyJsonBytes, err := json.Marshal(e.Body)
+// toPayload converts the input to a payload, naming query parameters with the policy
+func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) toPayload(codec Codec, queryNaming NamingPolicy) (InputPayload, error) {
+
+	var bodyBytes []byte
+	var bodyReader io.Reader
+	var bodyContentType string
+	var err error
+	if codec.IsStreaming() {
+		bodyReader, bodyContentType, err = codec.Encode(e.Body)
+	} else {
+		bodyBytes, err = codec.Marshal(e.Body)
+	}
 	if err != nil {
 		return InputPayload{}, fmt.Errorf("failed to marshal body: %w", err)
 	}
 
-	serializeUrlValue := func(value reflect.Value) (string, error) {
-		str, err := json.Marshal(value.Interface())
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal path parameter '%s': %w", value, err)
-		}
-		return strings.TrimSuffix(strings.TrimPrefix(string(str), "\""), "\""), nil
-	}
-
-	// Serialize headers
+	// Serialize headers and cookies
 	headers := map[string][]string{}
+	cookies := map[string]string{}
+	cookieOrder := make([]string, 0)
 	headersInfo, err := GetStructInfo(e.Headers)
 	if err != nil {
 		return InputPayload{}, fmt.Errorf("failed to analyze headers struct: %w", err)
@@ -126,16 +156,37 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) ToPayload() (
 			if valuePtr == nil && field.IsRequired() {
 				return InputPayload{}, fmt.Errorf("missing required header parameter '%s'", field.Name)
 			}
-			if valuePtr == nil {
+			if valuePtr == nil || isUnsetOptional(reflect.ValueOf(valuePtr).Elem()) {
+				continue
+			}
+			if field.IsHeaderList() {
+				values, err := headerListValues(reflect.ValueOf(valuePtr).Elem())
+				if err != nil {
+					return InputPayload{}, fmt.Errorf("failed to serialize header parameter '%s': %w", field.Name, err)
+				}
+				if len(values) > 0 {
+					headers[key] = values
+				}
 				continue
 			}
 			valueSerialized, err := serializeUrlValue(reflect.ValueOf(valuePtr).Elem())
 			if err != nil {
 				return InputPayload{}, err
 			}
-			headers[key] = []string{valueSerialized}
+			if field.IsCookie() {
+				cookies[field.Name] = valueSerialized
+				cookieOrder = append(cookieOrder, field.Name)
+			} else {
+				headers[key] = []string{valueSerialized}
+			}
 		}
 	}
+	if len(cookieOrder) > 0 {
+		headers["Cookie"] = []string{requestCookieHeader(cookies, cookieOrder)}
+	}
+	if bodyContentType != "" {
+		headers["Content-Type"] = []string{bodyContentType}
+	}
 
 	// serialize path
 	path := map[string]string{}
@@ -151,13 +202,21 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) ToPayload() (
 			// Check if it has a tag called path
 			pathTag := field.StructField.Tag.Get("path")
 			if pathTag == "" {
-				// Treat as wildcard
-				//path += "/*"
-				return InputPayload{}, fmt.Errorf("wildcard path parameters not yet supported, field: %s", field.Name)
+				// Treat as wildcard, which has no value to serialize
+				return InputPayload{}, fmt.Errorf("unbound wildcard path segments can't be serialized, bind them to a field with a `path:\"*\"` tag")
 			} else {
 				// Treat as literal
 				pathStr += "/" + strings.TrimPrefix(pathTag, "/")
 			}
+		} else if field.IsCatchAll() {
+			// escape each segment, keeping the slashes
+			valueSerialized := reflect.ValueOf(e.Path).Field(i).String()
+			segments := strings.Split(valueSerialized, "/")
+			for j, segment := range segments {
+				segments[j] = url.PathEscape(segment)
+			}
+			pathStr += "/" + strings.Join(segments, "/")
+			path[catchAllPathParam] = valueSerialized
 		} else {
 			valueSerialized, err := serializeUrlValue(reflect.ValueOf(e.Path).Field(i))
 			if err != nil {
@@ -180,25 +239,30 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) ToPayload() (
 		field := queryInfo.Fields[i]
 		tpe := field.Type
 		value := reflect.ValueOf(e.Query).Field(i)
-		if tpe.Kind() == reflect.Ptr && value.IsNil() {
+		if tpe.Kind() == reflect.Ptr && value.IsNil() || isUnsetOptional(value) {
 			continue
 		}
 
-		if field.Name != "_" && field.Name != "" {
+		if field.HasFieldNameInStruct() && field.IsDeepObject() {
+			if err := encodeFormValue(query, field.ParamName(queryNaming), value); err != nil {
+				return InputPayload{}, err
+			}
+		} else if field.HasFieldNameInStruct() {
 			valueSerialized, err := serializeUrlValue(value)
 			if err != nil {
 				return InputPayload{}, err
 			}
-			query[field.Name] = []string{valueSerialized}
+			query[field.ParamName(queryNaming)] = []string{valueSerialized}
 		}
 	}
 
 	return InputPayload{
-		Headers: headers,
-		Path:    path,
-		PathStr: pathStr,
-		Query:   query,
-		Body:    bodyJsonBytes,
+		Headers:    headers,
+		Path:       path,
+		PathStr:    pathStr,
+		Query:      query,
+		Body:       bodyBytes,
+		BodyReader: bodyReader,
 	}, nil
 }
 
@@ -208,6 +272,7 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) getPath() any
 
 func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) parse(
 	payload InputPayload,
+	codec Codec,
 	headerBindings HeaderBindings,
 	pathBindings PathBindings,
 	queryBindings QueryBindings,
@@ -261,13 +326,58 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) parse(
 		}
 	}
 
+	for name, setter := range headerBindings.Lists {
+		fieldInfo, ok := headerStructInfo.FieldsByLKName[name]
+		if !ok {
+			return result, fmt.Errorf("failed to find header parameter info '%s'", name)
+		}
+		valueToSet := reflect.ValueOf(&result.Headers).Elem().Field(fieldInfo.Index)
+		if err := setter(valueToSet, payload.Headers[name]); err != nil {
+			return result, fmt.Errorf("failed to set header parameter '%s': %w", name, err)
+		}
+	}
+
+	// parse cookies
+	if len(headerBindings.Cookies) > 0 {
+		cookies := parseRequestCookies(payload.Headers)
+		for name, setter := range headerBindings.Cookies {
+			fieldInfo, ok := headerStructInfo.FieldsByName[name]
+			if !ok {
+				return result, fmt.Errorf("failed to find cookie info '%s'", name)
+			}
+			var inputValue *string
+			for _, cookie := range cookies {
+				if cookie.Name == name {
+					inputValue = &cookie.Value
+					break
+				}
+			}
+			valueToSet := reflect.ValueOf(&result.Headers).Elem().Field(fieldInfo.Index)
+			if err := setter(valueToSet, inputValue); err != nil {
+				return result, fmt.Errorf("failed to set cookie '%s': %w", name, err)
+			}
+		}
+	}
+
 	// parse path parameters
+	pathStructInfo, err := GetStructInfo(result.Path)
+	if err != nil {
+		return result, fmt.Errorf("failed to analyze path struct: %w", err)
+	}
 	for name, setter := range pathBindings.Bindings {
-		inputValue, ok := payload.Path[name]
+		key := name
+		if name == pathBindings.CatchAll {
+			key = catchAllPathParam
+		}
+		inputValue, ok := payload.Path[key]
 		if !ok {
 			return result, fmt.Errorf("missing path parameter '%s'", name)
 		}
-		valueToSet := reflect.ValueOf(&result.Path).Elem().FieldByName(name)
+		fieldInfo, ok := pathStructInfo.FieldsByName[name]
+		if !ok {
+			return result, fmt.Errorf("failed to find path parameter info '%s'", name)
+		}
+		valueToSet := reflect.ValueOf(&result.Path).Elem().Field(fieldInfo.Index)
 		err := setter(valueToSet, inputValue)
 		if err != nil {
 			return result, fmt.Errorf("failed to set path parameter '%s': %w", name, err)
@@ -277,7 +387,7 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) parse(
 	// parse query parameters
 	for name, setter := range queryBindings.Bindings {
 		inputValue := payload.Query[name]
-		valueToSet := reflect.ValueOf(&result.Query).Elem().FieldByName(name)
+		valueToSet := reflect.ValueOf(&result.Query).Elem().FieldByName(queryBindings.FieldNames[name])
 		if len(inputValue) > 1 {
 			return result, fmt.Errorf("repeated query parameters not yet supported, field: %s", name)
 		}
@@ -291,6 +401,22 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) parse(
 			return result, fmt.Errorf("failed to set query parameter '%s': %w", name, err)
 		}
 	}
+	if len(queryBindings.Objects) > 0 {
+		values := deepObjectValues(payload.Query)
+		for name, fieldName := range queryBindings.Objects {
+			valueToSet := reflect.ValueOf(&result.Query).Elem().FieldByName(fieldName)
+			if !hasFormKey(values, name) && (valueToSet.Kind() == reflect.Ptr || valueToSet.Kind() == reflect.Map) {
+				continue // Leave the target at nil/unset
+			}
+			if valueToSet.Kind() == reflect.Ptr {
+				valueToSet.Set(reflect.New(valueToSet.Type().Elem()))
+				valueToSet = valueToSet.Elem()
+			}
+			if err := decodeFormValue(values, name, valueToSet); err != nil {
+				return result, fmt.Errorf("failed to set query parameter '%s': %w", name, err)
+			}
+		}
+	}
 
 	// parse body
 	bodyT := reflect.TypeOf(e.Body)
@@ -301,9 +427,14 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) parse(
 	// num fields in body
 	numFields := bodyT.NumField()
 	if numFields >= 1 {
-		err := json.Unmarshal(payload.Body, &result.Body)
+		var err error
+		if codec.IsStreaming() {
+			err = codec.Decode(payload.bodyReader(), headerValue(payload.Headers, "Content-Type"), &result.Body)
+		} else {
+			err = codec.Unmarshal(payload.Body, &result.Body)
+		}
 		if err != nil {
-			return result, fmt.Errorf("failed to unmarshal body: %w", err)
+			return result, fmt.Errorf("failed to unmarshal %s body: %w", codec.MediaType, err)
 		}
 	}
 
@@ -312,16 +443,24 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) parse(
 
 type HeaderBindings struct {
 	Bindings map[string]headerFieldSetter
+	Lists    map[string]headerListFieldSetter // slice fields, by lower case name
+	Cookies  map[string]cookieFieldSetter
 }
 
 type PathBindings struct {
 	FlatPath string
 	Bindings map[string]pathFieldSetter
+	CatchAll string // the name of the field binding the rest of the path, if any
 }
 
+// catchAllPathParam is the key of the rest of the path in InputPayload.Path
+const catchAllPathParam = "*"
+
 type QueryBindings struct {
-	FlatPath string
-	Bindings map[string]queryFieldSetter
+	FlatPath   string
+	Bindings   map[string]queryFieldSetter
+	Objects    map[string]string // go field names of deepObject parameters by name
+	FieldNames map[string]string // go field names by parameter name
 }
 
 func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) calcHeaderBindings() HeaderBindings {
@@ -333,18 +472,31 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) calcHeaderBin
 
 	result := HeaderBindings{
 		Bindings: make(map[string]headerFieldSetter),
+		Lists:    make(map[string]headerListFieldSetter),
+		Cookies:  make(map[string]cookieFieldSetter),
 	}
 	alreadyTaken := make(map[string]bool)
+	cookiesTaken := make(map[string]bool)
 
 	// Iterate over fields in HeaderType
 	for _, field := range structInfo.Fields {
-		if field.Name != "_" {
+		if field.Name != "_" && field.IsCookie() {
+			if cookiesTaken[field.Name] {
+				panic(fmt.Sprintf("cookie '%s' is already taken", field.Name))
+			}
+			cookiesTaken[field.Name] = true
+			result.Cookies[field.Name] = getFromStringCookieFieldSetter(field.StructField, field.Name)
+		} else if field.Name != "_" {
 			key := field.LKName
 			if alreadyTaken[key] {
 				panic(fmt.Sprintf("header '%s' is already taken", key))
 			}
 			alreadyTaken[key] = true
-			result.Bindings[key] = getFromStringHeaderFieldSetter(field.StructField, key)
+			if field.IsHeaderList() {
+				result.Lists[key] = getFromStringListHeaderFieldSetter(field.StructField, key)
+			} else {
+				result.Bindings[key] = getFromStringHeaderFieldSetter(field.StructField, key)
+			}
 		}
 	}
 
@@ -364,15 +516,18 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) calcPathBindi
 	}
 	alreadyTaken := make(map[string]bool)
 
+	structInfo, err := GetStructInfoOfType(pathT)
+	if err != nil {
+		panic(fmt.Errorf("failed to analyze path: %w", err))
+	}
+
 	// Iterate over fields in PathType
-	for i := 0; i < pathT.NumField(); i++ {
-		// Check if the field has path
-		field := pathT.Field(i)
+	for i, field := range structInfo.Fields {
 
-		if field.Name == "_" {
+		if field.FieldName == "_" {
 			// We won't bind this parameter, but it is still needed in the path
 			// Check if it has a tag called path
-			pathTag := field.Tag.Get("path")
+			pathTag := field.StructField.Tag.Get("path")
 			if pathTag == "" {
 				// Treat as wildcard
 				result.FlatPath += "/*"
@@ -380,51 +535,75 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) calcPathBindi
 				// Treat as literal
 				result.FlatPath += "/" + strings.TrimPrefix(pathTag, "/")
 			}
-		} else {
-			if alreadyTaken[field.Name] {
-				panic(fmt.Sprintf("field '%s' is already taken", field.Name))
-			}
+			continue
+		}
 
-			alreadyTaken[field.Name] = true
+		if alreadyTaken[field.Name] {
+			panic(fmt.Sprintf("path parameter '%s' is already taken", field.Name))
+		}
+		alreadyTaken[field.Name] = true
+
+		if field.IsCatchAll() {
+			if i != len(structInfo.Fields)-1 {
+				panic(fmt.Sprintf("catch-all path field '%s' must be the last field", field.Name))
+			}
+			if field.Type.Kind() != reflect.String {
+				panic(fmt.Sprintf("catch-all path field '%s' must be a string", field.Name))
+			}
+			result.FlatPath += "/*"
+			result.CatchAll = field.Name
+		} else {
 			result.FlatPath += "/:" + field.Name
-			result.Bindings[field.Name] = getFromStringPathFieldSetter(field)
 		}
+		result.Bindings[field.Name] = getPatternPathFieldSetter(field, getFromStringPathFieldSetter(field.StructField))
 	}
 
 	return result
 }
 
-func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) calcQueryBindings() QueryBindings {
+func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) calcQueryBindings(naming NamingPolicy) QueryBindings {
 
-	pathT := reflect.TypeOf((*QueryType)(nil)).Elem()
-	if pathT.Kind() != reflect.Struct {
+	queryT := reflect.TypeOf((*QueryType)(nil)).Elem()
+	if queryT.Kind() != reflect.Struct {
 		panic("QueryType must be a struct")
 	}
 
+	structInfo, err := GetStructInfoOfType(queryT)
+	if err != nil {
+		panic(fmt.Errorf("failed to analyze query: %w", err))
+	}
+
 	result := QueryBindings{
-		Bindings: make(map[string]queryFieldSetter),
+		Bindings:   make(map[string]queryFieldSetter),
+		Objects:    make(map[string]string),
+		FieldNames: make(map[string]string),
 	}
-	alreadyTaken := make(map[string]bool)
 
-	// Iterate over fields in PathType
-	for i := 0; i < pathT.NumField(); i++ {
-		// Check if the field has path
-		field := pathT.Field(i)
+	// Iterate over fields in QueryType
+	for _, field := range structInfo.Fields {
 
-		if field.Name != "_" {
-			if alreadyTaken[field.Name] {
-				panic(fmt.Sprintf("field '%s' is already taken", field.Name))
-			}
+		if !field.HasFieldNameInStruct() {
+			continue
+		}
 
-			isFirst := len(result.Bindings) == 0
-			separator := "&"
-			if isFirst {
-				separator = "?"
-			}
-			alreadyTaken[field.Name] = true
-			result.FlatPath += separator + field.Name + "=.."
-			result.Bindings[field.Name] = getFromStringQueryFieldSetter(field)
+		name := field.ParamName(naming)
+		if _, taken := result.FieldNames[name]; taken {
+			panic(fmt.Sprintf("query parameter '%s' is already taken", name))
+		}
+
+		isFirst := len(result.FieldNames) == 0
+		separator := "&"
+		if isFirst {
+			separator = "?"
+		}
+		if field.IsDeepObject() {
+			result.FlatPath += separator + name + "[..]=.."
+			result.Objects[name] = field.FieldName
+		} else {
+			result.FlatPath += separator + name + "=.."
+			result.Bindings[name] = getFromStringQueryFieldSetter(field.StructField, name)
 		}
+		result.FieldNames[name] = field.FieldName
 	}
 
 	return result
@@ -435,6 +614,7 @@ func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) validateBodyT
 	if bodyT.Kind() != reflect.Struct && bodyT.Kind() != reflect.Slice {
 		panic("BodyType must be a struct or slice")
 	}
+	validateJsonBodyType(bodyT, map[reflect.Type]bool{})
 }
 
 func (e EndpointInput[HeadersType, PathType, QueryType, BodyType]) getQuery() any {
@@ -455,7 +635,7 @@ func calcPathBindings[Input EndpointInputBase]() PathBindings {
 	return zero.calcPathBindings()
 }
 
-func calcQueryBindings[Input EndpointInputBase]() QueryBindings {
+func calcQueryBindings[Input EndpointInputBase](naming NamingPolicy) QueryBindings {
 	var zero Input
-	return zero.calcQueryBindings()
+	return zero.calcQueryBindings(naming)
 }
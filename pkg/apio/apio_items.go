@@ -0,0 +1,370 @@
+package apio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+const MediaTypeNDJson = "application/x-ndjson"
+
+// itemsMediaTypes are the default media types of Items bodies
+var itemsMediaTypes = []string{MediaTypeNDJson, MediaTypeJson}
+
+// NDJsonCodec encodes slices and Items as newline delimited JSON, one item per line
+var NDJsonCodec = Codec{
+	MediaType: MediaTypeNDJson,
+	Marshal:   marshalNDJson,
+	Unmarshal: func(data []byte, v any) error {
+		return decodeNDJson(bytes.NewReader(data), MediaTypeNDJson, v)
+	},
+	Encode: encodeNDJson,
+	Decode: decodeNDJson,
+}
+
+// ItemsBody is implemented by Items. They are analyzed and documented like slices of their item type.
+type ItemsBody interface {
+	ItemType() reflect.Type
+}
+
+var itemsBodyType = reflect.TypeOf((*ItemsBody)(nil)).Elem()
+
+// itemsSourceBody and itemsTarget let codecs stream Items of any item type
+type itemsSourceBody interface {
+	itemsReader(mediaType string) io.Reader
+}
+
+type itemsTarget interface {
+	setReader(reader io.Reader, contentType string)
+}
+
+// Items is a streamed body of items, for payloads too large to hold in memory
+// as a slice. It is encoded as NDJSON, or as a JSON array. Received items are
+// read with Next, and are only readable once. Items to send are written by
+// the function given to NewItems, which runs when the body is encoded.
+type Items[T any] struct {
+	src *itemsSource[T]
+}
+
+type itemsSource[T any] struct {
+	mutex   sync.Mutex
+	produce func(w *ItemWriter[T]) error
+	// readerMutex guards reader, so that Close doesn't wait for a blocked Next
+	readerMutex sync.Mutex
+	reader      io.Reader
+	mediaType   string
+	decoder     *json.Decoder
+	ended       bool
+}
+
+// NewItems returns items written by produce. Writing fails once the receiver is gone.
+func NewItems[T any](produce func(w *ItemWriter[T]) error) Items[T] {
+	return Items[T]{src: &itemsSource[T]{produce: produce}}
+}
+
+// ItemsOf returns items of a slice
+func ItemsOf[T any](items []T) Items[T] {
+	return NewItems(func(w *ItemWriter[T]) error {
+		for _, item := range items {
+			if err := w.Write(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (i Items[T]) ItemType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Next returns the next item, or io.EOF after the last one
+func (i Items[T]) Next() (T, error) {
+	var result T
+	if i.src == nil {
+		return result, io.EOF
+	}
+	s := i.src
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ended {
+		return result, io.EOF
+	}
+	if s.decoder == nil {
+		if produce := s.takeProducer(); produce != nil { // produced locally, e.g. by a mocked handler
+			s.readerMutex.Lock()
+			s.reader = Items[T]{src: &itemsSource[T]{produce: produce}}.itemsReader(MediaTypeNDJson)
+			s.readerMutex.Unlock()
+			s.mediaType = MediaTypeNDJson
+		}
+		s.readerMutex.Lock()
+		reader := s.reader
+		s.readerMutex.Unlock()
+		if reader == nil {
+			s.ended = true
+			return result, io.EOF
+		}
+		s.decoder = json.NewDecoder(reader)
+		if s.mediaType == MediaTypeJson {
+			if token, err := s.decoder.Token(); err != nil || token != json.Delim('[') {
+				return result, fmt.Errorf("expected a JSON array of items")
+			}
+		}
+	}
+	if s.mediaType == MediaTypeJson && !s.decoder.More() {
+		s.ended = true
+		if _, err := s.decoder.Token(); err != nil {
+			return result, fmt.Errorf("failed to read end of JSON array: %w", err)
+		}
+		return result, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := s.decoder.Decode(&raw); err != nil {
+		if err == io.EOF {
+			s.ended = true
+		}
+		return result, err
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return result, fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	return result, nil
+}
+
+// ForEach calls fn for every item, until fn fails
+func (i Items[T]) ForEach(fn func(item T) error) error {
+	defer func() { _ = i.Close() }()
+	for {
+		item, err := i.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+}
+
+// Collect reads all items into a slice
+func (i Items[T]) Collect() ([]T, error) {
+	result := make([]T, 0)
+	err := i.ForEach(func(item T) error {
+		result = append(result, item)
+		return nil
+	})
+	return result, err
+}
+
+// Close closes the underlying reader, e.g. to stop receiving early
+func (i Items[T]) Close() error {
+	if i.src == nil {
+		return nil
+	}
+	i.src.readerMutex.Lock()
+	reader := i.src.reader
+	i.src.readerMutex.Unlock()
+	if closer, ok := reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ServeHTTP writes the items as NDJSON or a JSON array, as negotiated with the Accept header
+func (i Items[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() { _ = i.Close() }()
+	mediaType, ok := NegotiateMediaType(r.Header.Get("Accept"), itemsMediaTypes)
+	if !ok {
+		mediaType = MediaTypeNDJson
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := i.writeTo(r.Context(), w, mediaType); err != nil && r.Context().Err() == nil {
+		slog.Error(fmt.Sprintf("failed to write items: %v", err))
+	}
+}
+
+func (i Items[T]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := i.writeTo(context.Background(), &buf, MediaTypeJson); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (i *Items[T]) UnmarshalJSON(data []byte) error {
+	i.setReader(bytes.NewReader(bytes.Clone(data)), MediaTypeJson)
+	return nil
+}
+
+func (i *Items[T]) setReader(reader io.Reader, contentType string) {
+	mediaType := baseMediaType(contentType)
+	if mediaType != MediaTypeJson {
+		mediaType = MediaTypeNDJson
+	}
+	i.src = &itemsSource[T]{reader: reader, mediaType: mediaType}
+}
+
+// itemsReader encodes the items through a pipe, so that they are never all in memory
+func (i Items[T]) itemsReader(mediaType string) io.Reader {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		_ = pipeWriter.CloseWithError(i.writeTo(context.Background(), pipeWriter, mediaType))
+	}()
+	return pipeReader
+}
+
+// writeTo encodes the items, running the producer or relaying received items
+func (i Items[T]) writeTo(ctx context.Context, writer io.Writer, mediaType string) error {
+	itemWriter := &ItemWriter[T]{ctx: ctx, writer: writer, mediaType: mediaType}
+	var produce func(w *ItemWriter[T]) error
+	if i.src != nil {
+		i.src.mutex.Lock()
+		produce = i.src.takeProducer()
+		i.src.mutex.Unlock()
+	}
+	var err error
+	if produce != nil {
+		err = produce(itemWriter)
+	} else {
+		err = i.ForEach(itemWriter.Write)
+	}
+	if err != nil {
+		return err
+	}
+	return itemWriter.finish()
+}
+
+// takeProducer returns the producer, if the items haven't been produced yet
+func (s *itemsSource[T]) takeProducer() func(w *ItemWriter[T]) error {
+	produce := s.produce
+	s.produce = nil
+	return produce
+}
+
+// ItemWriter writes typed items of a streamed body
+type ItemWriter[T any] struct {
+	ctx       context.Context
+	writer    io.Writer
+	mediaType string
+	count     int
+}
+
+// Context is cancelled when the receiver is gone
+func (w *ItemWriter[T]) Context() context.Context {
+	return w.ctx
+}
+
+// Write encodes an item. It blocks while the receiver is not keeping up.
+func (w *ItemWriter[T]) Write(item T) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item: %w", err)
+	}
+	var buf bytes.Buffer
+	if w.mediaType == MediaTypeJson {
+		if w.count == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(data)
+	} else {
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	w.count++
+	_, err = w.writer.Write(buf.Bytes())
+	return err
+}
+
+func (w *ItemWriter[T]) finish() error {
+	if w.mediaType != MediaTypeJson {
+		return nil
+	}
+	end := "]"
+	if w.count == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(w.writer, end)
+	return err
+}
+
+func marshalNDJson(v any) ([]byte, error) {
+	body, _, err := encodeNDJson(v)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(body)
+}
+
+func encodeNDJson(v any) (io.Reader, string, error) {
+	if items, ok := v.(itemsSourceBody); ok {
+		return items.itemsReader(MediaTypeNDJson), MediaTypeNDJson, nil
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice {
+		return nil, "", fmt.Errorf("%s bodies must be slices or Items, got %T", MediaTypeNDJson, v)
+	}
+	var buf bytes.Buffer
+	for i := 0; i < value.Len(); i++ {
+		data, err := json.Marshal(value.Index(i).Interface())
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal item %d: %w", i, err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return &buf, MediaTypeNDJson, nil
+}
+
+// decodeNDJson reads Items lazily, and slices right away
+func decodeNDJson(body io.Reader, contentType string, v any) error {
+	if target, ok := v.(itemsTarget); ok {
+		target.setReader(body, contentType)
+		return nil
+	}
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%s bodies must be decoded into slice pointers or Items, got %T", MediaTypeNDJson, v)
+	}
+	slice := reflect.MakeSlice(ptr.Elem().Type(), 0, 0)
+	decoder := json.NewDecoder(body)
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read item %d: %w", slice.Len(), err)
+		}
+		item := reflect.New(slice.Type().Elem())
+		if err := json.Unmarshal(raw, item.Interface()); err != nil {
+			return fmt.Errorf("failed to unmarshal item %d: %w", slice.Len(), err)
+		}
+		slice = reflect.Append(slice, item.Elem())
+	}
+	ptr.Elem().Set(slice)
+	return nil
+}
+
+func isItemsType(t reflect.Type) bool {
+	return t != nil && t.Implements(itemsBodyType)
+}
@@ -0,0 +1,212 @@
+package apio
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type record struct {
+	Id   int
+	Name string
+}
+
+type recordsPath struct {
+	_ any `path:"/records"`
+}
+
+type recordsQuery struct {
+	Count int
+}
+
+type importResult struct {
+	Count int
+	Sum   int
+}
+
+type exportInput = EndpointInput[X, recordsPath, recordsQuery, X]
+type exportOutput = EndpointOutput[X, Items[record]]
+
+var exportEndpoint = Endpoint[exportInput, exportOutput]{
+	Method: http.MethodGet,
+	Handler: func(input exportInput) (exportOutput, error) {
+		return BodyResponse(NewItems(func(w *ItemWriter[record]) error {
+			for i := 1; i <= input.Query.Count; i++ {
+				if err := w.Write(record{Id: i, Name: "record\n" + strings.Repeat("x", i)}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})), nil
+	},
+}
+
+type importInput = EndpointInput[X, recordsPath, X, Items[record]]
+type importOutput = EndpointOutput[X, importResult]
+
+var importEndpoint = Endpoint[importInput, importOutput]{
+	Method: http.MethodPost,
+	Handler: func(input importInput) (importOutput, error) {
+		var result importResult
+		err := input.Body.ForEach(func(item record) error {
+			result.Count++
+			result.Sum += item.Id
+			return nil
+		})
+		if err != nil {
+			return importOutput{}, NewError(http.StatusBadRequest, err.Error(), err)
+		}
+		return BodyResponse(result), nil
+	},
+}
+
+func expectedRecords(n int) []record {
+	result := make([]record, 0)
+	for i := 1; i <= n; i++ {
+		result = append(result, record{Id: i, Name: "record\n" + strings.Repeat("x", i)})
+	}
+	return result
+}
+
+func TestItemsExport(t *testing.T) {
+	api := Api{Name: "items"}.WithEndpoints(exportEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	if diff := cmp.Diff(itemsMediaTypes, exportEndpoint.GetProduces()); diff != "" {
+		t.Fatalf("unexpected default media types (-want +got):\n%s", diff)
+	}
+
+	client := exportEndpoint
+	client.Handler = nil
+	output, err := client.RPC(server, NewInput(Empty, recordsPath{}, recordsQuery{Count: 100}, Empty), DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	records, err := output.Body.Collect()
+	if err != nil {
+		t.Fatalf("failed to read items: %v", err)
+	}
+	if diff := cmp.Diff(expectedRecords(100), records); diff != "" {
+		t.Fatalf("unexpected records (-want +got):\n%s", diff)
+	}
+
+	for mediaType, expected := range map[string]string{
+		MediaTypeNDJson: `{"Id":1,"Name":"record\nx"}` + "\n" + `{"Id":2,"Name":"record\nxx"}` + "\n",
+		MediaTypeJson:   `[{"Id":1,"Name":"record\nx"},{"Id":2,"Name":"record\nxx"}]`,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, requestUrl(server, InputPayload{PathStr: "/records", Query: map[string][]string{"Count": {"2"}}}), nil)
+		req.Header.Set("Accept", mediaType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.Header.Get("Content-Type") != mediaType {
+			t.Fatalf("expected content type %s, got %s", mediaType, resp.Header.Get("Content-Type"))
+		}
+		if diff := cmp.Diff(expected, string(body)); diff != "" {
+			t.Fatalf("unexpected %s body (-want +got):\n%s", mediaType, diff)
+		}
+	}
+}
+
+func TestItemsImport(t *testing.T) {
+	api := Api{Name: "items"}.WithEndpoints(importEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	client := importEndpoint
+	client.Handler = nil
+	output, err := client.RPC(server, NewInput(Empty, recordsPath{}, Empty, ItemsOf(expectedRecords(1000))), DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	if diff := cmp.Diff(importResult{Count: 1000, Sum: 500500}, output.Body); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	for contentType, body := range map[string]string{
+		MediaTypeJson:   `[{"Id":1},{"Id":2},{"Id":3}]`,
+		MediaTypeNDJson: "{\"Id\":1}\n{\"Id\":2}\n\n{\"Id\":3}",
+	} {
+		resp, err := http.Post(requestUrl(server, InputPayload{PathStr: "/records"}), contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if diff := cmp.Diff(`{"Count":3,"Sum":6}`, string(respBody)); diff != "" {
+			t.Fatalf("unexpected %s result (-want +got):\n%s", contentType, diff)
+		}
+	}
+
+	resp, err := http.Post(requestUrl(server, InputPayload{PathStr: "/records"}), MediaTypeNDJson, strings.NewReader("{\"Id\":1}\nnot json\n"))
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid items, got %d", resp.StatusCode)
+	}
+}
+
+func TestItemsLocalHandler(t *testing.T) {
+	output, err := exportEndpoint.RPC(Server{}, NewInput(Empty, recordsPath{}, recordsQuery{Count: 3}, Empty), DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	records, err := output.Body.Collect()
+	if err != nil {
+		t.Fatalf("failed to read items: %v", err)
+	}
+	if diff := cmp.Diff(expectedRecords(3), records); diff != "" {
+		t.Fatalf("unexpected records (-want +got):\n%s", diff)
+	}
+}
+
+func TestNDJsonCodecSlices(t *testing.T) {
+	data, err := NDJsonCodec.Marshal(expectedRecords(2))
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if diff := cmp.Diff("{\"Id\":1,\"Name\":\"record\\nx\"}\n{\"Id\":2,\"Name\":\"record\\nxx\"}\n", string(data)); diff != "" {
+		t.Fatalf("unexpected ndjson (-want +got):\n%s", diff)
+	}
+	var records []record
+	if err := NDJsonCodec.Unmarshal(data, &records); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(expectedRecords(2), records); diff != "" {
+		t.Fatalf("unexpected records (-want +got):\n%s", diff)
+	}
+}
+
+func TestItemsCloseWhileIterating(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	items := NewItems(func(w *ItemWriter[record]) error {
+		<-release
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := items.Next() // blocks, as nothing is written
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := items.Close(); err != nil {
+		t.Fatalf("failed to close items: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected an error from Next after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Next was not stopped by Close")
+	}
+}
@@ -0,0 +1,414 @@
+package apio
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWTClaims are the verified claims of a JWT bearer token
+type JWTClaims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt *time.Time
+	NotBefore *time.Time
+	IssuedAt  *time.Time
+	Scopes    []string
+	Raw       map[string]any // all claims, as decoded from the token
+}
+
+// HasScopes returns true if the claims grant all the given scopes
+func (c JWTClaims) HasScopes(scopes ...string) bool {
+	for _, required := range scopes {
+		found := false
+		for _, granted := range c.Scopes {
+			if granted == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// JWTVerifier verifies HS256, RS256 and ES256 signed JWT bearer tokens using
+// locally supplied keys. It can be used as a SchemeVerifier (see
+// Api.WithVerifiers), or as the Authenticator of a SecureEndpoint to get the
+// claims as a typed principal.
+type JWTVerifier struct {
+	// Keys by key id ("kid"). A token without a kid can use any of the keys.
+	// []byte for HS256, *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256.
+	Keys map[string]crypto.PublicKey
+	// Issuer is the required "iss" claim, if set
+	Issuer string
+	// Audience must be present in the "aud" claim, if set
+	Audience string
+	// Leeway is the allowed clock skew when checking "exp" and "nbf"
+	Leeway time.Duration
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+func NewJWTVerifier() *JWTVerifier {
+	return &JWTVerifier{
+		Keys: map[string]crypto.PublicKey{},
+	}
+}
+
+func (v *JWTVerifier) WithHMACKey(kid string, secret []byte) *JWTVerifier {
+	v.Keys[kid] = secret
+	return v
+}
+
+func (v *JWTVerifier) WithPublicKey(kid string, key crypto.PublicKey) *JWTVerifier {
+	v.Keys[kid] = key
+	return v
+}
+
+func (v *JWTVerifier) WithIssuer(issuer string) *JWTVerifier {
+	v.Issuer = issuer
+	return v
+}
+
+func (v *JWTVerifier) WithAudience(audience string) *JWTVerifier {
+	v.Audience = audience
+	return v
+}
+
+// WithJWKSFile adds all the keys of a JWKS (json web key set) file
+func (v *JWTVerifier) WithJWKSFile(path string) (*JWTVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return v, fmt.Errorf("failed to read jwks file: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return v, err
+	}
+	for kid, key := range keys {
+		v.Keys[kid] = key
+	}
+	return v, nil
+}
+
+// ParseJWKS parses the keys of a JWKS (json web key set) document, by key id
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+	b64 := base64.RawURLEncoding
+	result := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, errN := b64.DecodeString(k.N)
+			e, errE := b64.DecodeString(k.E)
+			if err := errors.Join(errN, errE); err != nil {
+				return nil, fmt.Errorf("invalid RSA key '%s': %w", k.Kid, err)
+			}
+			result[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				return nil, fmt.Errorf("unsupported EC curve '%s' for key '%s'", k.Crv, k.Kid)
+			}
+			x, errX := b64.DecodeString(k.X)
+			y, errY := b64.DecodeString(k.Y)
+			if err := errors.Join(errX, errY); err != nil {
+				return nil, fmt.Errorf("invalid EC key '%s': %w", k.Kid, err)
+			}
+			result[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		case "oct":
+			secret, err := b64.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("invalid symmetric key '%s': %w", k.Kid, err)
+			}
+			result[k.Kid] = secret
+		default:
+			return nil, fmt.Errorf("unsupported key type '%s' for key '%s'", k.Kty, k.Kid)
+		}
+	}
+	return result, nil
+}
+
+func jwtUnauthorized(format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	return NewError(http.StatusUnauthorized, "invalid token: "+msg, errors.New(msg))
+}
+
+// Verify checks the signature and the registered claims of a token.
+// Failures are returned as 401 ErrResps.
+func (v *JWTVerifier) Verify(token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return JWTClaims{}, jwtUnauthorized("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerBytes, &header) != nil {
+		return JWTClaims{}, jwtUnauthorized("malformed header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return JWTClaims{}, jwtUnauthorized("malformed signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if !v.verifySignature(header.Alg, header.Kid, signed, signature) {
+		return JWTClaims{}, jwtUnauthorized("bad signature")
+	}
+
+	claimsBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return JWTClaims{}, jwtUnauthorized("malformed claims")
+	}
+	raw := map[string]any{}
+	decoder := json.NewDecoder(strings.NewReader(string(claimsBytes)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return JWTClaims{}, jwtUnauthorized("malformed claims")
+	}
+
+	claims, err := parseJWTClaims(raw)
+	if err != nil {
+		return JWTClaims{}, jwtUnauthorized("%v", err)
+	}
+
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Add(v.Leeway)) {
+		return JWTClaims{}, jwtUnauthorized("token expired")
+	}
+	if claims.NotBefore != nil && now.Before(claims.NotBefore.Add(-v.Leeway)) {
+		return JWTClaims{}, jwtUnauthorized("token not yet valid")
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return JWTClaims{}, jwtUnauthorized("unexpected issuer '%s'", claims.Issuer)
+	}
+	if v.Audience != "" && !containsString(claims.Audience, v.Audience) {
+		return JWTClaims{}, jwtUnauthorized("unexpected audience %v", claims.Audience)
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) verifySignature(alg string, kid string, signed []byte, signature []byte) bool {
+	candidates := make([]crypto.PublicKey, 0, 1)
+	if kid != "" {
+		if key, ok := v.Keys[kid]; ok {
+			candidates = append(candidates, key)
+		}
+	} else {
+		for _, key := range v.Keys {
+			candidates = append(candidates, key)
+		}
+	}
+	digest := sha256.Sum256(signed)
+	for _, key := range candidates {
+		// the key type must match the algorithm, to prevent algorithm confusion
+		switch k := key.(type) {
+		case []byte:
+			if alg != "HS256" {
+				continue
+			}
+			mac := hmac.New(sha256.New, k)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if alg != "RS256" {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if alg != "ES256" || len(signature) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(k, digest[:], r, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseJWTClaims(raw map[string]any) (JWTClaims, error) {
+	claims := JWTClaims{Raw: raw}
+
+	stringClaim := func(name string) (string, error) {
+		value, ok := raw[name]
+		if !ok {
+			return "", nil
+		}
+		str, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("claim '%s' must be a string", name)
+		}
+		return str, nil
+	}
+	timeClaim := func(name string) (*time.Time, error) {
+		value, ok := raw[name]
+		if !ok {
+			return nil, nil
+		}
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("claim '%s' must be a number", name)
+		}
+		seconds, err := number.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("claim '%s' must be a number", name)
+		}
+		t := time.Unix(0, int64(seconds*float64(time.Second)))
+		return &t, nil
+	}
+	stringsClaim := func(name string, separator string) ([]string, error) {
+		switch value := raw[name].(type) {
+		case nil:
+			return nil, nil
+		case string:
+			if separator == "" {
+				return []string{value}, nil
+			}
+			return strings.Fields(value), nil
+		case []any:
+			result := make([]string, 0, len(value))
+			for _, item := range value {
+				str, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("claim '%s' must only contain strings", name)
+				}
+				result = append(result, str)
+			}
+			return result, nil
+		default:
+			return nil, fmt.Errorf("claim '%s' must be a string or an array of strings", name)
+		}
+	}
+
+	var errs []error
+	var err error
+	claims.Subject, err = stringClaim("sub")
+	errs = append(errs, err)
+	claims.Issuer, err = stringClaim("iss")
+	errs = append(errs, err)
+	claims.Audience, err = stringsClaim("aud", "")
+	errs = append(errs, err)
+	claims.ExpiresAt, err = timeClaim("exp")
+	errs = append(errs, err)
+	claims.NotBefore, err = timeClaim("nbf")
+	errs = append(errs, err)
+	claims.IssuedAt, err = timeClaim("iat")
+	errs = append(errs, err)
+	if _, ok := raw["scope"]; ok {
+		claims.Scopes, err = stringsClaim("scope", " ")
+	} else {
+		claims.Scopes, err = stringsClaim("scp", " ")
+	}
+	errs = append(errs, err)
+
+	return claims, errors.Join(errs...)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyWithScopes verifies the token and checks that it grants the scopes.
+// Missing scopes are returned as a 403 ErrResp.
+func (v *JWTVerifier) verifyWithScopes(token string, scopes []string) (JWTClaims, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return claims, err
+	}
+	if !claims.HasScopes(scopes...) {
+		return claims, NewError(
+			http.StatusForbidden,
+			fmt.Sprintf("insufficient scope, required: %v", scopes),
+			fmt.Errorf("token scopes %v, required: %v", claims.Scopes, scopes),
+		)
+	}
+	return claims, nil
+}
+
+// Authenticate can be used as the Authenticator of a SecureEndpoint,
+// with the verified claims as principal
+func (v *JWTVerifier) Authenticate(creds Credentials) (JWTClaims, error) {
+	return v.verifyWithScopes(creds.Token, creds.RequiredScopes)
+}
+
+// Verifies returns true for bearer schemes, see SchemeVerifier
+func (v *JWTVerifier) Verifies(scheme SecurityScheme) bool {
+	return scheme.Type == SecurityTypeHttp && scheme.Scheme == "bearer"
+}
+
+// VerifyCredentials verifies a bearer token and its scopes, see SchemeVerifier
+func (v *JWTVerifier) VerifyCredentials(creds Credentials) error {
+	_, err := v.Authenticate(creds)
+	return err
+}
+
+// Middleware verifies the bearer token of every request to an endpoint with
+// a bearer security scheme, and enforces the endpoint's scopes. Requests
+// presenting other credentials are rejected, unless the endpoint is Secured.
+// Use Api.WithVerifiers instead to combine verifiers of several schemes.
+func (v *JWTVerifier) Middleware() Middleware {
+	verifiers := []SchemeVerifier{v}
+	return func(endpoint EndpointBase, payload InputPayload, next HandleFunc) (EndpointOutputBase, error) {
+		if err := verifyCredentials(verifiers, endpoint, payload); err != nil {
+			return nil, err
+		}
+		return next(payload)
+	}
+}
@@ -0,0 +1,278 @@
+package apio
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signTestJWT(t *testing.T, alg string, kid string, key any, claims map[string]any) string {
+	b64 := base64.RawURLEncoding
+	header := must(json.Marshal(map[string]any{"alg": alg, "typ": "JWT", "kid": kid}))
+	payload := must(json.Marshal(claims))
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature = must(rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]))
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64.EncodeToString(signature)
+}
+
+func TestJWTVerifyAlgorithms(t *testing.T) {
+	rsaKey := must(rsa.GenerateKey(rand.Reader, 2048))
+	ecKey := must(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))
+	hmacKey := []byte("top-secret")
+
+	verifier := NewJWTVerifier().
+		WithHMACKey("h", hmacKey).
+		WithPublicKey("r", &rsaKey.PublicKey).
+		WithPublicKey("e", &ecKey.PublicKey).
+		WithIssuer("me").
+		WithAudience("api")
+
+	claims := map[string]any{
+		"sub":   "alice",
+		"iss":   "me",
+		"aud":   []string{"api", "other"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "read write",
+	}
+
+	tokens := map[string]string{
+		"HS256": signTestJWT(t, "HS256", "h", hmacKey, claims),
+		"RS256": signTestJWT(t, "RS256", "r", rsaKey, claims),
+		"ES256": signTestJWT(t, "ES256", "e", ecKey, claims),
+	}
+	for alg, token := range tokens {
+		verified, err := verifier.Verify(token)
+		if err != nil {
+			t.Fatalf("%s: failed to verify: %v", alg, err)
+		}
+		if verified.Subject != "alice" || !verified.HasScopes("read", "write") {
+			t.Fatalf("%s: unexpected claims: %+v", alg, verified)
+		}
+	}
+
+	// algorithm confusion: HS256 signed with the public RSA key id
+	confused := signTestJWT(t, "HS256", "r", []byte("whatever"), claims)
+	if _, err := verifier.Verify(confused); err == nil {
+		t.Fatalf("expected error for mismatching algorithm")
+	}
+}
+
+func TestJWTVerifyRejectsBadClaims(t *testing.T) {
+	key := []byte("top-secret")
+	verifier := NewJWTVerifier().WithHMACKey("", key).WithIssuer("me").WithAudience("api")
+
+	cases := map[string]map[string]any{
+		"expired":     {"iss": "me", "aud": "api", "exp": time.Now().Add(-time.Minute).Unix()},
+		"not before":  {"iss": "me", "aud": "api", "nbf": time.Now().Add(time.Minute).Unix()},
+		"wrong iss":   {"iss": "you", "aud": "api"},
+		"wrong aud":   {"iss": "me", "aud": "web"},
+		"bad claim":   {"iss": "me", "aud": "api", "exp": "tomorrow"},
+		"bad signing": nil,
+	}
+	for name, claims := range cases {
+		token := signTestJWT(t, "HS256", "", key, claims)
+		if claims == nil {
+			token = signTestJWT(t, "HS256", "", []byte("other-secret"), map[string]any{"iss": "me", "aud": "api"})
+		}
+		_, err := verifier.Verify(token)
+		if errResp := AsErResp(err); errResp == nil || errResp.Status != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got %v", name, err)
+		}
+	}
+}
+
+func TestJWTMiddlewareScopes(t *testing.T) {
+	key := []byte("top-secret")
+	verifier := NewJWTVerifier().WithHMACKey("", key)
+
+	endpoint := Endpoint[EndpointInput[X, X, X, X], EndpointOutput[X, X]]{
+		Method:   http.MethodDelete,
+		Security: []SecurityScheme{BearerAuth("bearer")},
+		Scopes:   []string{"admin"},
+		Handler: func(input EndpointInput[X, X, X, X]) (EndpointOutput[X, X], error) {
+			return EmptyResponse(), nil
+		},
+	}
+	api := Api{Name: "jwt"}.WithEndpoints(endpoint).WithMiddlewares(verifier.Middleware()).Validate(true)
+
+	call := func(token string) error {
+		headers := map[string][]string{}
+		if token != "" {
+			headers["Authorization"] = []string{"Bearer " + token}
+		}
+		_, err := api.Handle(endpoint, InputPayload{Headers: headers})
+		return err
+	}
+
+	if errResp := AsErResp(call("")); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token")
+	}
+	if errResp := AsErResp(call(signTestJWT(t, "HS256", "", key, map[string]any{"scp": []string{"read"}}))); errResp == nil || errResp.Status != http.StatusForbidden {
+		t.Fatalf("expected 403 without scope")
+	}
+	if err := call(signTestJWT(t, "HS256", "", key, map[string]any{"scp": []string{"read", "admin"}})); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+}
+
+func TestJWTMiddlewareWithOtherSchemes(t *testing.T) {
+	key := []byte("top-secret")
+	verifier := NewJWTVerifier().WithHMACKey("", key)
+
+	endpoint := Endpoint[EndpointInput[X, X, X, X], EndpointOutput[X, X]]{
+		Method:   http.MethodGet,
+		Security: []SecurityScheme{BearerAuth("bearer"), ApiKeyInHeader("key", "X-Api-Key")},
+		Handler: func(input EndpointInput[X, X, X, X]) (EndpointOutput[X, X], error) {
+			return EmptyResponse(), nil
+		},
+	}
+	api := Api{Name: "jwt"}.WithEndpoints(endpoint).WithMiddlewares(verifier.Middleware()).Validate(true)
+
+	call := func(headers map[string][]string) error {
+		_, err := api.Handle(endpoint, InputPayload{Headers: headers})
+		return err
+	}
+
+	if errResp := AsErResp(call(map[string][]string{})); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials")
+	}
+	if errResp := AsErResp(call(map[string][]string{"Authorization": {"Bearer nope"}})); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with an invalid token")
+	}
+	if errResp := AsErResp(call(map[string][]string{"X-Api-Key": {"bogus"}})); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with an unverified api key")
+	}
+	if err := call(map[string][]string{"Authorization": {"Bearer " + signTestJWT(t, "HS256", "", key, map[string]any{})}}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+}
+
+type testApiKeyVerifier struct{}
+
+func (testApiKeyVerifier) Verifies(scheme SecurityScheme) bool {
+	return scheme.Type == SecurityTypeApiKey
+}
+
+func (testApiKeyVerifier) VerifyCredentials(creds Credentials) error {
+	if creds.Token != "secret" {
+		return errors.New("unknown api key")
+	}
+	return nil
+}
+
+func TestApiVerifiers(t *testing.T) {
+	key := []byte("top-secret")
+
+	endpoint := Endpoint[EndpointInput[X, X, X, X], EndpointOutput[X, X]]{
+		Method:   http.MethodGet,
+		Security: []SecurityScheme{BearerAuth("bearer"), ApiKeyInHeader("key", "X-Api-Key")},
+		Handler: func(input EndpointInput[X, X, X, X]) (EndpointOutput[X, X], error) {
+			return EmptyResponse(), nil
+		},
+	}
+	jwtOnly := Api{Name: "jwt"}.WithEndpoints(endpoint).WithVerifiers(NewJWTVerifier().WithHMACKey("", key)).Validate(true)
+	both := jwtOnly.WithVerifiers(testApiKeyVerifier{})
+
+	call := func(api Api, headers map[string][]string) int {
+		_, err := api.Handle(endpoint, InputPayload{Headers: headers})
+		if errResp := AsErResp(err); errResp != nil {
+			return errResp.Status
+		}
+		return http.StatusOK
+	}
+
+	for _, api := range []Api{jwtOnly, both} {
+		if status := call(api, map[string][]string{}); status != http.StatusUnauthorized {
+			t.Fatalf("expected 401 without credentials, got %d", status)
+		}
+		if status := call(api, map[string][]string{"Authorization": {"Bearer " + signTestJWT(t, "HS256", "", key, map[string]any{})}}); status != http.StatusOK {
+			t.Fatalf("expected a valid token to be accepted, got %d", status)
+		}
+	}
+	if status := call(jwtOnly, map[string][]string{"X-Api-Key": {"secret"}}); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an api key without verifier, got %d", status)
+	}
+	if status := call(both, map[string][]string{"X-Api-Key": {"bogus"}}); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bogus api key, got %d", status)
+	}
+	if status := call(both, map[string][]string{"X-Api-Key": {"secret"}}); status != http.StatusOK {
+		t.Fatalf("expected a verified api key to be accepted, got %d", status)
+	}
+}
+
+func TestJWTExpiresAtBoundary(t *testing.T) {
+	key := []byte("top-secret")
+	exp := time.Unix(time.Now().Unix(), 0)
+	verifier := NewJWTVerifier().WithHMACKey("", key)
+	verifier.Now = func() time.Time { return exp }
+
+	_, err := verifier.Verify(signTestJWT(t, "HS256", "", key, map[string]any{"exp": exp.Unix()}))
+	if errResp := AsErResp(err); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected a token to be expired at exactly exp, got %v", err)
+	}
+	verifier.Now = func() time.Time { return exp.Add(-time.Second) }
+	if _, err := verifier.Verify(signTestJWT(t, "HS256", "", key, map[string]any{"exp": exp.Unix()})); err != nil {
+		t.Fatalf("expected a token to be valid before exp, got %v", err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey := must(rsa.GenerateKey(rand.Reader, 2048))
+	ecKey := must(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))
+	b64 := base64.RawURLEncoding
+	jwks := fmt.Sprintf(`{"keys":[
+		{"kty":"RSA","kid":"r","n":"%s","e":"%s"},
+		{"kty":"EC","kid":"e","crv":"P-256","x":"%s","y":"%s"},
+		{"kty":"oct","kid":"h","k":"%s"}
+	]}`,
+		b64.EncodeToString(rsaKey.N.Bytes()),
+		b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		b64.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		b64.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+		b64.EncodeToString([]byte("top-secret")),
+	)
+	keys, err := ParseJWKS([]byte(jwks))
+	if err != nil {
+		t.Fatalf("failed to parse jwks: %v", err)
+	}
+	verifier := NewJWTVerifier()
+	verifier.Keys = keys
+
+	claims := map[string]any{"sub": "bob"}
+	for _, token := range []string{
+		signTestJWT(t, "RS256", "r", rsaKey, claims),
+		signTestJWT(t, "ES256", "e", ecKey, claims),
+		signTestJWT(t, "HS256", "h", []byte("top-secret"), claims),
+	} {
+		if _, err := verifier.Verify(token); err != nil {
+			t.Fatalf("failed to verify with jwks key: %v", err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package apio
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HandleFunc handles a request payload, see EndpointBase.Handle
+type HandleFunc func(payload InputPayload) (EndpointOutputBase, error)
+
+// Middleware wraps the handling of requests. It can inspect or modify the
+// payload, reject the request by returning an error (preferably an ErrResp),
+// or call next to continue. Server adapters run the Api's middlewares, in
+// order, before Endpoint.Handle.
+type Middleware func(endpoint EndpointBase, payload InputPayload, next HandleFunc) (EndpointOutputBase, error)
+
+// SchemeVerifier verifies the credentials of the security schemes it handles,
+// for endpoints that are not Secured. See Api.WithVerifiers.
+type SchemeVerifier interface {
+	Verifies(scheme SecurityScheme) bool
+	VerifyCredentials(creds Credentials) error
+}
+
+// Handle runs the api middlewares, verifies the credentials of the request
+// and then runs the endpoint handler
+func (a *Api) Handle(endpoint EndpointBase, payload InputPayload) (EndpointOutputBase, error) {
+	handle := HandleFunc(func(payload InputPayload) (EndpointOutputBase, error) {
+		if err := verifyCredentials(a.Verifiers, endpoint, payload); err != nil {
+			return nil, err
+		}
+		return endpoint.Handle(payload)
+	})
+	for i := len(a.Middlewares) - 1; i >= 0; i-- {
+		middleware := a.Middlewares[i]
+		next := handle
+		handle = func(payload InputPayload) (EndpointOutputBase, error) {
+			return middleware(endpoint, payload, next)
+		}
+	}
+	return handle(payload)
+}
+
+func findVerifier(verifiers []SchemeVerifier, scheme SecurityScheme) SchemeVerifier {
+	for _, verifier := range verifiers {
+		if verifier.Verifies(scheme) {
+			return verifier
+		}
+	}
+	return nil
+}
+
+// verifyCredentials verifies the credentials of the first of the endpoint's
+// schemes that is both verified and present in the payload. Credentials of
+// schemes without a verifier are not accepted, unless none of the schemes
+// has a verifier (security is then not enforced) or the endpoint is Secured.
+func verifyCredentials(verifiers []SchemeVerifier, endpoint EndpointBase, payload InputPayload) error {
+	if _, ok := endpoint.(securedEndpoint); ok {
+		return nil
+	}
+	enforced := false
+	for _, scheme := range endpoint.GetSecurity() {
+		verifier := findVerifier(verifiers, scheme)
+		if verifier == nil {
+			continue
+		}
+		enforced = true
+		creds, ok := scheme.Extract(payload)
+		if !ok {
+			continue
+		}
+		creds.RequiredScopes = endpoint.GetScopes()
+		if err := verifier.VerifyCredentials(creds); err != nil {
+			var errResp *ErrResp
+			if errors.As(err, &errResp) {
+				return errResp
+			}
+			return NewError(http.StatusUnauthorized, "invalid credentials", err)
+		}
+		return nil
+	}
+	if enforced {
+		return NewError(http.StatusUnauthorized, "missing credentials", nil)
+	}
+	return nil
+}
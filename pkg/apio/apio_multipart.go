@@ -0,0 +1,318 @@
+package apio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"reflect"
+)
+
+const MediaTypeMultipart = "multipart/form-data"
+
+// MultipartMaxMemory is how much of the files of a multipart body are kept in
+// memory when decoding, larger files are spilled to temporary files
+var MultipartMaxMemory int64 = 32 << 20
+
+// MultipartMaxBytes limits the size of decoded multipart bodies, including
+// spilled files, unlimited if 0. Larger bodies get 413. Endpoint.MaxBodyBytes
+// can be used for lower limits per endpoint.
+var MultipartMaxBytes int64 = 1 << 30
+
+// MultipartMaxParts limits the number of parts of decoded multipart bodies,
+// unlimited if 0. Bodies with more parts get 413.
+var MultipartMaxParts = 1000
+
+// multipartMaxValueBytes limits the size of each non-file part
+const multipartMaxValueBytes = 1 << 20
+
+// MultipartCodec streams struct bodies as multipart form data. Fields are
+// named like form fields. File fields (File, *File or []File) become file
+// parts, other fields become values. Decoded files are closed when the
+// handler returns.
+var MultipartCodec = Codec{
+	MediaType: MediaTypeMultipart,
+	Marshal:   marshalMultipart,
+	Unmarshal: func(data []byte, v any) error {
+		return fmt.Errorf("%s bodies must be decoded with a content type", MediaTypeMultipart)
+	},
+	Encode: encodeMultipart,
+	Decode: decodeMultipart,
+}
+
+// File is a file part of a multipart body
+type File struct {
+	Filename    string
+	ContentType string
+	Size        int64 // -1 if unknown
+	Reader      io.Reader
+}
+
+var fileType = reflect.TypeOf(File{})
+
+func NewFile(filename string, contentType string, reader io.Reader) File {
+	return File{Filename: filename, ContentType: contentType, Size: -1, Reader: reader}
+}
+
+// Close closes the file reader, if it is closable
+func (f File) Close() error {
+	if closer, ok := f.Reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func isFileField(t reflect.Type) bool {
+	return t == fileType || t == reflect.PointerTo(fileType) || t == reflect.SliceOf(fileType)
+}
+
+// closeFiles closes the files of a decoded body, removing temporary files
+func closeFiles(body any) {
+	value := reflect.ValueOf(body)
+	if value.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < value.NumField(); i++ {
+		if !isFileField(value.Type().Field(i).Type) {
+			continue
+		}
+		for _, file := range filesOf(value.Field(i)) {
+			_ = file.Close()
+		}
+	}
+}
+
+func marshalMultipart(v any) ([]byte, error) {
+	body, _, err := encodeMultipart(v)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(body)
+}
+
+// encodeMultipart streams the body through a pipe, so that files aren't buffered
+func encodeMultipart(v any) (io.Reader, string, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Struct {
+		return nil, "", fmt.Errorf("multipart bodies must be structs, got %v", value.Type())
+	}
+	fields, err := formFields(value.Type())
+	if err != nil {
+		return nil, "", err
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		err := writeMultipartFields(writer, fields, value)
+		if err == nil {
+			err = writer.Close()
+		}
+		_ = pipeWriter.CloseWithError(err)
+	}()
+	return pipeReader, writer.FormDataContentType(), nil
+}
+
+func writeMultipartFields(writer *multipart.Writer, fields []FieldInfo, value reflect.Value) error {
+	for _, field := range fields {
+		fieldValue := value.Field(field.Index)
+		if isFileField(field.Type) {
+			for _, file := range filesOf(fieldValue) {
+				if err := writeMultipartFile(writer, field.Name, file); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		form := url.Values{}
+		if err := encodeFormValue(form, field.Name, fieldValue); err != nil {
+			return err
+		}
+		for key, values := range form {
+			for _, v := range values {
+				if err := writer.WriteField(key, v); err != nil {
+					return fmt.Errorf("failed to write multipart field '%s': %w", key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func filesOf(value reflect.Value) []File {
+	switch v := value.Interface().(type) {
+	case File:
+		return []File{v}
+	case *File:
+		if v == nil {
+			return nil
+		}
+		return []File{*v}
+	case []File:
+		return v
+	}
+	return nil
+}
+
+func writeMultipartFile(writer *multipart.Writer, name string, file File) error {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": name, "filename": file.Filename}))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create multipart file '%s': %w", name, err)
+	}
+	if file.Reader == nil {
+		return nil
+	}
+	if _, err := io.Copy(part, file.Reader); err != nil {
+		return fmt.Errorf("failed to write multipart file '%s': %w", name, err)
+	}
+	return nil
+}
+
+// decodeMultipart reads the parts one by one. Values and up to
+// MultipartMaxMemory of files are kept in memory, larger files are spilled to
+// temporary files, which are removed when the files are closed.
+func decodeMultipart(body io.Reader, contentType string, v any) (err error) {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("multipart bodies must be decoded into struct pointers, got %T", v)
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return fmt.Errorf("missing multipart boundary in content type '%s'", contentType)
+	}
+	target := ptr.Elem()
+	fields, err := formFields(target.Type())
+	if err != nil {
+		return err
+	}
+	isFile := make(map[string]bool)
+	for _, field := range fields {
+		isFile[field.Name] = isFileField(field.Type)
+	}
+
+	if MultipartMaxBytes > 0 {
+		body = http.MaxBytesReader(nil, io.NopCloser(body), MultipartMaxBytes)
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	values := url.Values{}
+	files := make(map[string][]File)
+	defer func() {
+		if err != nil {
+			for _, fieldFiles := range files {
+				closeFiles(struct{ Files []File }{fieldFiles})
+			}
+		}
+	}()
+	memory := MultipartMaxMemory
+	for parts := 0; ; parts++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read multipart form: %w", err)
+		}
+		if MultipartMaxParts > 0 && parts >= MultipartMaxParts {
+			return NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("more than %d multipart parts", MultipartMaxParts), nil)
+		}
+		name := part.FormName()
+		if part.FileName() != "" {
+			if !isFile[name] {
+				continue // unknown files are skipped, like unknown values
+			}
+			file, err := readMultipartFile(part, &memory)
+			if err != nil {
+				return fmt.Errorf("failed to read multipart file '%s': %w", name, err)
+			}
+			files[name] = append(files[name], file)
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, multipartMaxValueBytes+1))
+		if err != nil {
+			return fmt.Errorf("failed to read multipart field '%s': %w", name, err)
+		}
+		if len(value) > multipartMaxValueBytes {
+			return NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("multipart field '%s' larger than %d bytes", name, multipartMaxValueBytes), nil)
+		}
+		values.Add(name, string(value))
+	}
+
+	for _, field := range fields {
+		if !isFileField(field.Type) {
+			continue
+		}
+		fieldFiles := files[field.Name]
+		if len(fieldFiles) == 0 {
+			if field.Type == fileType {
+				return fmt.Errorf("missing required multipart file '%s'", field.Name)
+			}
+			continue
+		}
+		fieldValue := target.Field(field.Index)
+		switch {
+		case field.Type == fileType:
+			fieldValue.Set(reflect.ValueOf(fieldFiles[0]))
+		case field.IsPointer:
+			fieldValue.Set(reflect.ValueOf(&fieldFiles[0]))
+		default:
+			fieldValue.Set(reflect.ValueOf(fieldFiles))
+		}
+	}
+	return decodeFormStruct(values, "", target)
+}
+
+// readMultipartFile reads a file part into memory, if it fits in what is
+// left of the memory budget, or else into a temporary file
+func readMultipartFile(part *multipart.Part, memory *int64) (File, error) {
+	file := File{Filename: part.FileName(), ContentType: part.Header.Get("Content-Type")}
+	var buf bytes.Buffer
+	size, err := io.CopyN(&buf, part, *memory+1)
+	if err != nil && err != io.EOF {
+		return file, err
+	}
+	if size <= *memory {
+		*memory -= size
+		file.Size = size
+		file.Reader = bytes.NewReader(buf.Bytes())
+		return file, nil
+	}
+
+	tmp, err := os.CreateTemp("", "apio-multipart-")
+	if err != nil {
+		return file, err
+	}
+	spilled := tempFile{tmp}
+	size, err = io.Copy(tmp, io.MultiReader(&buf, part))
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = spilled.Close()
+		return file, err
+	}
+	file.Size = size
+	file.Reader = spilled
+	return file, nil
+}
+
+// tempFile is a file part spilled to disk, removed when closed
+type tempFile struct {
+	*os.File
+}
+
+func (f tempFile) Close() error {
+	return errors.Join(f.File.Close(), os.Remove(f.Name()))
+}
@@ -0,0 +1,204 @@
+package apio
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+type uploadPath struct {
+	_ any `path:"/uploads"`
+}
+
+type uploadBody struct {
+	Title       string `name:"title"`
+	Tags        []string
+	Avatar      File
+	Attachments []File
+	Extra       *File
+}
+
+type uploadedFile struct {
+	Name        string
+	ContentType string
+	Content     string
+}
+
+type uploadResult struct {
+	Title string
+	Tags  []string
+	Files []uploadedFile
+}
+
+type uploadEndpointT = Endpoint[
+	EndpointInput[X, uploadPath, X, uploadBody],
+	EndpointOutput[X, uploadResult],
+]
+
+func uploadHandler(input EndpointInput[X, uploadPath, X, uploadBody]) (EndpointOutput[X, uploadResult], error) {
+	result := uploadResult{Title: input.Body.Title, Tags: input.Body.Tags}
+	files := append([]File{input.Body.Avatar}, input.Body.Attachments...)
+	if input.Body.Extra != nil {
+		files = append(files, *input.Body.Extra)
+	}
+	for _, file := range files {
+		content, err := io.ReadAll(file.Reader)
+		if err != nil {
+			return EndpointOutput[X, uploadResult]{}, err
+		}
+		_ = file.Close()
+		result.Files = append(result.Files, uploadedFile{Name: file.Filename, ContentType: file.ContentType, Content: string(content)})
+	}
+	return BodyResponse(result), nil
+}
+
+func TestMultipartUpload(t *testing.T) {
+	endpoint := uploadEndpointT{
+		Method:       http.MethodPost,
+		Consumes:     []string{MediaTypeMultipart},
+		MaxBodyBytes: 64 << 10,
+	}
+	api := Api{Name: "uploads"}.WithEndpoints(endpoint.WithHandler(uploadHandler)).Validate(true)
+	server := startTestServer(t, &api)
+
+	input := NewInput(Empty, uploadPath{}, Empty, uploadBody{
+		Title:  "holiday",
+		Tags:   []string{"beach", "sun"},
+		Avatar: NewFile("me.png", "image/png", strings.NewReader("png-bytes")),
+		Attachments: []File{
+			NewFile("a.txt", "text/plain", strings.NewReader("first")),
+			NewFile("b.txt", "", strings.NewReader("second")),
+		},
+	})
+	res, err := endpoint.RPC(server, input, DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	expected := uploadResult{
+		Title: "holiday",
+		Tags:  []string{"beach", "sun"},
+		Files: []uploadedFile{
+			{Name: "me.png", ContentType: "image/png", Content: "png-bytes"},
+			{Name: "a.txt", ContentType: "text/plain", Content: "first"},
+			{Name: "b.txt", ContentType: "application/octet-stream", Content: "second"},
+		},
+	}
+	if diff := cmp.Diff(expected, res.Body); diff != "" {
+		t.Fatalf("upload mismatch:\n%s", diff)
+	}
+
+	// larger than MultipartMaxMemory, so spilled to a temporary file
+	defer func(maxMemory int64) { MultipartMaxMemory = maxMemory }(MultipartMaxMemory)
+	MultipartMaxMemory = 1024
+	big := strings.Repeat("x", 32<<10)
+	input.Body.Avatar = NewFile("big.bin", "", strings.NewReader(big))
+	input.Body.Attachments = nil
+	res, err = endpoint.RPC(server, input, DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to upload big file: %v", err)
+	}
+	if len(res.Body.Files) != 1 || res.Body.Files[0].Content != big {
+		t.Fatalf("big file mismatch")
+	}
+
+	input.Body.Avatar = NewFile("huge.bin", "", strings.NewReader(strings.Repeat("x", 128<<10)))
+	_, err = endpoint.RPC(server, input, DefaultOpts())
+	var errResp ErrResp
+	if !errors.As(err, &errResp) || errResp.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %v", err)
+	}
+}
+
+func TestMultipartMissingFile(t *testing.T) {
+	endpoint := uploadEndpointT{
+		Method:   http.MethodPost,
+		Consumes: []string{MediaTypeMultipart},
+	}.WithHandler(uploadHandler)
+
+	// a body without the required Avatar file
+	body, contentType, err := MultipartCodec.Encode(struct {
+		Title string `name:"title"`
+	}{Title: "no files"})
+	if err != nil {
+		t.Fatalf("failed to encode multipart body: %v", err)
+	}
+	payload := InputPayload{Headers: map[string][]string{"Content-Type": {contentType}}, BodyReader: body}
+	_, err = endpoint.Handle(payload)
+	if errResp := AsErResp(err); errResp == nil || errResp.Status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for missing file, got %v", err)
+	}
+}
+
+func TestMultipartFilesClosedAfterHandler(t *testing.T) {
+	defer func(maxMemory int64) { MultipartMaxMemory = maxMemory }(MultipartMaxMemory)
+	MultipartMaxMemory = 1024 // so that files are spilled to temporary files
+
+	var kept File
+	endpoint := uploadEndpointT{
+		Method:   http.MethodPost,
+		Consumes: []string{MediaTypeMultipart},
+	}.WithHandler(func(input EndpointInput[X, uploadPath, X, uploadBody]) (EndpointOutput[X, uploadResult], error) {
+		kept = input.Body.Avatar
+		return BodyResponse(uploadResult{}), nil
+	})
+
+	body, contentType, err := MultipartCodec.Encode(uploadBody{
+		Avatar: NewFile("big.bin", "", strings.NewReader(strings.Repeat("x", 32<<10))),
+	})
+	if err != nil {
+		t.Fatalf("failed to encode multipart body: %v", err)
+	}
+	payload := InputPayload{Headers: map[string][]string{"Content-Type": {contentType}}, BodyReader: body}
+	if _, err := endpoint.Handle(payload); err != nil {
+		t.Fatalf("failed to handle upload: %v", err)
+	}
+	if _, err := kept.Reader.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Fatalf("expected the file to be closed after the handler returned, got %v", err)
+	}
+	spilled, ok := kept.Reader.(tempFile)
+	if !ok {
+		t.Fatalf("expected the file to be spilled to a temporary file, got %T", kept.Reader)
+	}
+	if _, err := os.Stat(spilled.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the temporary file to be removed after the handler returned, got %v", err)
+	}
+}
+
+func TestMultipartLimits(t *testing.T) {
+	defer func(maxBytes int64, maxParts int) {
+		MultipartMaxBytes, MultipartMaxParts = maxBytes, maxParts
+	}(MultipartMaxBytes, MultipartMaxParts)
+
+	endpoint := uploadEndpointT{
+		Method:   http.MethodPost,
+		Consumes: []string{MediaTypeMultipart},
+	}.WithHandler(uploadHandler)
+	upload := func(body uploadBody) error {
+		reader, contentType, err := MultipartCodec.Encode(body)
+		if err != nil {
+			t.Fatalf("failed to encode multipart body: %v", err)
+		}
+		_, err = endpoint.Handle(InputPayload{Headers: map[string][]string{"Content-Type": {contentType}}, BodyReader: reader})
+		return err
+	}
+	avatar := func() File {
+		return NewFile("me.png", "image/png", strings.NewReader(strings.Repeat("x", 4<<10)))
+	}
+
+	MultipartMaxBytes, MultipartMaxParts = 2<<10, 0
+	if errResp := AsErResp(upload(uploadBody{Avatar: avatar()})); errResp == nil || errResp.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a body larger than MultipartMaxBytes, got %v", errResp)
+	}
+
+	MultipartMaxBytes, MultipartMaxParts = 0, 3
+	if err := upload(uploadBody{Title: "ok", Avatar: avatar(), Tags: []string{"a"}}); err != nil {
+		t.Fatalf("expected 3 parts to be accepted, got %v", err)
+	}
+	if errResp := AsErResp(upload(uploadBody{Title: "too many", Avatar: avatar(), Tags: []string{"a", "b"}})); errResp == nil || errResp.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for more than MultipartMaxParts parts, got %v", errResp)
+	}
+}
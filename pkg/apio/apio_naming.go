@@ -0,0 +1,48 @@
+package apio
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NamingPolicy converts Go field names to parameter names, e.g. SnakeCase
+type NamingPolicy func(fieldName string) string
+
+// CamelCase names PageSize pageSize, and ID id
+func CamelCase(fieldName string) string {
+	runes := []rune(fieldName)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	// keep the last capital of a leading acronym, e.g. HTTPServer -> httpServer
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// SnakeCase names PageSize page_size
+func SnakeCase(fieldName string) string {
+	return strings.ReplaceAll(camelCaseToKebabCase(fieldName), "-", "_")
+}
+
+// KebabCase names PageSize page-size
+func KebabCase(fieldName string) string {
+	return camelCaseToKebabCase(fieldName)
+}
+
+// ParamName returns the name of the field as a parameter. Name tags take
+// precedence over the naming policy, field names are used as is without one.
+func (a *FieldInfo) ParamName(naming NamingPolicy) string {
+	if a.OverrideName != "" {
+		return a.OverrideName
+	}
+	if naming != nil {
+		return naming(a.FieldName)
+	}
+	return a.FieldName
+}
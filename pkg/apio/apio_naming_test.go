@@ -0,0 +1,101 @@
+package apio
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+)
+
+func TestNamingPolicies(t *testing.T) {
+	for fieldName, expected := range map[string][3]string{
+		"PageSize":   {"pageSize", "page_size", "page-size"},
+		"ID":         {"id", "id", "id"},
+		"UserID":     {"userID", "user_id", "user-id"},
+		"HTTPServer": {"httpServer", "httpserver", "httpserver"},
+		"name":       {"name", "name", "name"},
+	} {
+		actual := [3]string{CamelCase(fieldName), SnakeCase(fieldName), KebabCase(fieldName)}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("unexpected names of %s (-want +got):\n%s", fieldName, diff)
+		}
+	}
+}
+
+type pageQuery struct {
+	PageSize int
+	SortBy   *string `name:"order"`
+}
+
+type pageInput = EndpointInput[X, recordsPath, pageQuery, X]
+type pageOutput = EndpointOutput[X, pageQuery]
+
+var pageEndpoint = Endpoint[pageInput, pageOutput]{
+	Method: http.MethodGet,
+	Handler: func(input pageInput) (pageOutput, error) {
+		return BodyResponse(input.Query), nil
+	},
+}
+
+func TestQueryNaming(t *testing.T) {
+	endpoint := pageEndpoint
+	endpoint.QueryNaming = SnakeCase
+	if endpoint.GetQueryPattern() != "?page_size=..&order=.." {
+		t.Fatalf("unexpected query pattern %s", endpoint.GetQueryPattern())
+	}
+	api := Api{Name: "naming"}.WithEndpoints(endpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	client := endpoint
+	client.Handler = nil
+	order := "name"
+	input := NewInput(Empty, recordsPath{}, pageQuery{PageSize: 10, SortBy: &order}, Empty)
+	output, err := client.RPC(server, input, DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	if diff := cmp.Diff(input.Query, output.Body); diff != "" {
+		t.Fatalf("unexpected query (-want +got):\n%s", diff)
+	}
+
+	for query, expectedStatus := range map[string]int{
+		"?page_size=10&order=name": http.StatusOK,
+		"?page_size=10":            http.StatusOK,
+		"?PageSize=10":             http.StatusBadRequest,
+		"?page_size=10&SortBy=x":   http.StatusOK,
+	} {
+		resp, err := http.Get(requestUrl(server, InputPayload{PathStr: "/records"}) + query)
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("expected status %d for %s, got %d", expectedStatus, query, resp.StatusCode)
+		}
+	}
+}
+
+var snakePageEndpoint = Endpoint[pageInput, pageOutput]{
+	Method:      http.MethodGet,
+	QueryNaming: SnakeCase,
+}
+
+func TestSharedQueryNaming(t *testing.T) {
+	serverSide := snakePageEndpoint.WithHandler(func(input pageInput) (pageOutput, error) {
+		return BodyResponse(input.Query), nil
+	})
+	api := Api{Name: "naming"}.WithEndpoints(serverSide).Validate(true)
+	server := startTestServer(t, &api)
+
+	input := NewInput(Empty, recordsPath{}, pageQuery{PageSize: 10}, Empty)
+	payload := must(snakePageEndpoint.ToPayload(input))
+	if payload.QueryString() != "?page_size=10" {
+		t.Fatalf("expected the endpoint naming policy in the payload, got %s", payload.QueryString())
+	}
+	output, err := snakePageEndpoint.RPC(server, input, DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	if diff := cmp.Diff(input.Query, output.Body); diff != "" {
+		t.Fatalf("unexpected query (-want +got):\n%s", diff)
+	}
+}
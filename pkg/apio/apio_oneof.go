@@ -0,0 +1,262 @@
+package apio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OneOfInfo describes a sealed set of concrete variants of an interface type.
+// Values are told apart by a discriminator property in their json representation.
+type OneOfInfo struct {
+	Interface     reflect.Type
+	Discriminator string
+	Variants      map[string]reflect.Type // discriminator value -> concrete type
+}
+
+// OneOfVariant is a concrete type of a oneOf, see Variant and RegisterOneOf
+type OneOfVariant struct {
+	Name string
+	Type reflect.Type
+}
+
+var oneOfRegistry = sync.Map{}
+
+// Variant declares T as a variant of a oneOf, identified by the discriminator value name
+func Variant[T any](name string) OneOfVariant {
+	return OneOfVariant{
+		Name: name,
+		Type: reflect.TypeOf((*T)(nil)).Elem(),
+	}
+}
+
+// RegisterOneOf registers the sealed set of variants of the interface type I,
+// so that apio can encode and decode OneOf[I] fields in bodies, and document
+// them as oneOf + discriminator in the OpenAPI spec. Example:
+//
+//	RegisterOneOf[Shape]("kind", Variant[Circle]("circle"), Variant[Square]("square"))
+//
+// The discriminator property is added to the json of each variant when encoding,
+// unless the variant already has a field with that name.
+func RegisterOneOf[I any](discriminator string, variants ...OneOfVariant) {
+	interfaceT := reflect.TypeOf((*I)(nil)).Elem()
+	if interfaceT.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("oneOf type must be an interface, but %v is a %s", interfaceT, interfaceT.Kind()))
+	}
+	if discriminator == "" {
+		panic(fmt.Sprintf("oneOf type %v must have a discriminator", interfaceT))
+	}
+	if len(variants) == 0 {
+		panic(fmt.Sprintf("oneOf type %v must have at least one variant", interfaceT))
+	}
+	info := OneOfInfo{
+		Interface:     interfaceT,
+		Discriminator: discriminator,
+		Variants:      make(map[string]reflect.Type),
+	}
+	for _, v := range variants {
+		if !v.Type.Implements(interfaceT) {
+			panic(fmt.Sprintf("oneOf variant %v does not implement %v", v.Type, interfaceT))
+		}
+		if _, exists := info.Variants[v.Name]; exists {
+			panic(fmt.Sprintf("oneOf variant name '%s' is already taken in %v", v.Name, interfaceT))
+		}
+		info.Variants[v.Name] = v.Type
+	}
+	oneOfRegistry.Store(interfaceT, info)
+}
+
+// GetOneOfInfo returns the registered oneOf info of the interface type t, if any
+func GetOneOfInfo(t reflect.Type) (OneOfInfo, bool) {
+	info, ok := oneOfRegistry.Load(t)
+	if !ok {
+		return OneOfInfo{}, false
+	}
+	return info.(OneOfInfo), true
+}
+
+// NameOf returns the discriminator value of the concrete type t
+func (o OneOfInfo) NameOf(t reflect.Type) (string, bool) {
+	for name, variantT := range o.Variants {
+		if variantT == t {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// VariantNames returns the discriminator values of all variants, sorted
+func (o OneOfInfo) VariantNames() []string {
+	names := make([]string, 0, len(o.Variants))
+	for name := range o.Variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OneOf holds a value of the registered oneOf interface type I. It encodes
+// the value with its discriminator, and decodes the variant it names.
+type OneOf[I any] struct {
+	Value I
+}
+
+// NewOneOf returns a OneOf holding value
+func NewOneOf[I any](value I) OneOf[I] {
+	return OneOf[I]{Value: value}
+}
+
+func (o OneOf[I]) oneOfInterfaceType() reflect.Type {
+	return reflect.TypeOf((*I)(nil)).Elem()
+}
+
+// oneOfField lets us reflect on OneOf of any interface type
+type oneOfField interface {
+	oneOfInterfaceType() reflect.Type
+}
+
+var oneOfFieldType = reflect.TypeOf((*oneOfField)(nil)).Elem()
+
+// OneOfInterfaceType returns I of a OneOf[I] type
+func OneOfInterfaceType(t reflect.Type) (reflect.Type, bool) {
+	if t == nil || t.Kind() != reflect.Struct || !t.Implements(oneOfFieldType) {
+		return nil, false
+	}
+	return reflect.Zero(t).Interface().(oneOfField).oneOfInterfaceType(), true
+}
+
+func (o OneOf[I]) info() (OneOfInfo, error) {
+	interfaceT := o.oneOfInterfaceType()
+	info, ok := GetOneOfInfo(interfaceT)
+	if !ok {
+		return info, fmt.Errorf("%v is not a registered oneOf type", interfaceT)
+	}
+	return info, nil
+}
+
+func (o OneOf[I]) MarshalJSON() ([]byte, error) {
+	value := reflect.ValueOf(&o.Value).Elem()
+	if value.IsNil() {
+		return []byte("null"), nil
+	}
+	info, err := o.info()
+	if err != nil {
+		return nil, err
+	}
+	concrete := value.Elem()
+	name, ok := info.NameOf(concrete.Type())
+	if !ok {
+		return nil, fmt.Errorf("type %v is not a registered variant of %v", concrete.Type(), info.Interface)
+	}
+	data, err := json.Marshal(concrete.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return withDiscriminator(data, info.Discriminator, name)
+}
+
+func (o *OneOf[I]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*o = OneOf[I]{}
+		return nil
+	}
+	info, err := o.info()
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("expected json object for %v: %w", info.Interface, err)
+	}
+	rawName, ok := fields[info.Discriminator]
+	if !ok {
+		return fmt.Errorf("missing discriminator '%s' for %v", info.Discriminator, info.Interface)
+	}
+	var name string
+	if err := json.Unmarshal(rawName, &name); err != nil {
+		return fmt.Errorf("discriminator '%s' for %v must be a string: %w", info.Discriminator, info.Interface, err)
+	}
+	variantT, ok := info.Variants[name]
+	if !ok {
+		return fmt.Errorf("unknown %s '%s' for %v, expected one of %v", info.Discriminator, name, info.Interface, info.VariantNames())
+	}
+	variant := reflect.New(variantT)
+	if err := json.Unmarshal(data, variant.Interface()); err != nil {
+		return err
+	}
+	o.Value = variant.Elem().Interface().(I)
+	return nil
+}
+
+// withDiscriminator adds the discriminator property to the json object of a
+// variant, unless the variant already has it
+func withDiscriminator(obj []byte, discriminator string, name string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(obj, &fields); err != nil {
+		return nil, fmt.Errorf("oneOf variants must be json objects: %w", err)
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("oneOf variants must be json objects, got %s", obj)
+	}
+	if _, exists := fields[discriminator]; exists {
+		return obj, nil
+	}
+	var buf bytes.Buffer
+	key, _ := json.Marshal(discriminator)
+	value, _ := json.Marshal(name)
+	buf.WriteString("{")
+	buf.Write(key)
+	buf.WriteString(":")
+	buf.Write(value)
+	rest := bytes.TrimSpace(obj)
+	rest = bytes.TrimSpace(rest[1:]) // skip '{'
+	if len(rest) > 0 && rest[0] != '}' {
+		buf.WriteString(",")
+	}
+	buf.Write(rest)
+	return buf.Bytes(), nil
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// validateJsonBodyType panics for fields of the body type t that encoding/json
+// would get wrong: Optional fields that are not tagged omitzero, as absent
+// values would be encoded as null, and oneOf interfaces not wrapped in OneOf
+func validateJsonBodyType(t reflect.Type, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	if valueType, ok := OptionalValueType(t); ok {
+		validateJsonBodyType(valueType, visited)
+		return
+	}
+	if t.Implements(jsonMarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		if _, ok := GetOneOfInfo(t); ok {
+			panic(fmt.Sprintf("oneOf type %v must be wrapped in OneOf[%v]", t, t))
+		}
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		validateJsonBodyType(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if (!field.IsExported() && !field.Anonymous) || tag == "-" {
+				continue
+			}
+			if isOptionalType(field.Type) && !slices.Contains(strings.Split(tag, ",")[1:], "omitzero") {
+				panic(fmt.Sprintf("Optional field %s of %v must be tagged `json:\",omitzero\"`", field.Name, t))
+			}
+			validateJsonBodyType(field.Type, visited)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package apio
+
+import (
+	"encoding/json"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+)
+
+type Shape interface {
+	Area() float64
+}
+
+type Circle struct {
+	Radius float64 `json:"radius"`
+}
+
+func (c Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type Square struct {
+	Side float64 `json:"side"`
+}
+
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+type Drawing struct {
+	Name   string                  `json:"name"`
+	Main   OneOf[Shape]            `json:"main"`
+	Others []OneOf[Shape]          `json:"others"`
+	ByName map[string]OneOf[Shape] `json:"byName,omitempty"`
+}
+
+func init() {
+	RegisterOneOf[Shape]("kind", Variant[Circle]("circle"), Variant[*Square]("square"))
+}
+
+func TestOneOfRoundTrip(t *testing.T) {
+
+	drawing := Drawing{
+		Name:   "d",
+		Main:   NewOneOf[Shape](Circle{Radius: 1}),
+		Others: []OneOf[Shape]{NewOneOf[Shape](&Square{Side: 2}), {}},
+		ByName: map[string]OneOf[Shape]{"c": NewOneOf[Shape](Circle{Radius: 3})},
+	}
+
+	encoded, err := json.Marshal(drawing)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	expJson := `{"name":"d","main":{"kind":"circle","radius":1},"others":[{"kind":"square","side":2},null],"byName":{"c":{"kind":"circle","radius":3}}}`
+	if string(encoded) != expJson {
+		t.Fatalf("unexpected json:\n%s\n%s", encoded, expJson)
+	}
+
+	var decoded Drawing
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(drawing, decoded); diff != "" {
+		t.Fatalf("round trip mismatch:\n%s", diff)
+	}
+}
+
+func TestOneOfUnknownVariant(t *testing.T) {
+	var decoded Drawing
+	err := json.Unmarshal([]byte(`{"name":"d","main":{"kind":"triangle"}}`), &decoded)
+	if err == nil {
+		t.Fatalf("expected error for unknown variant")
+	}
+}
+
+func TestOneOfBodyIsDecodedByHandle(t *testing.T) {
+
+	endpoint := Endpoint[
+		EndpointInput[X, X, X, Drawing],
+		EndpointOutput[X, Drawing],
+	]{
+		Method: http.MethodPost,
+		Handler: func(input EndpointInput[X, X, X, Drawing]) (EndpointOutput[X, Drawing], error) {
+			return BodyResponse(input.Body), nil
+		},
+	}
+
+	result, err := endpoint.Handle(InputPayload{
+		Body: []byte(`{"name":"d","main":{"kind":"square","side":4},"others":[]}`),
+	})
+	if err != nil {
+		t.Fatalf("failed to Handle call: %v", err)
+	}
+
+	bodyBytes, err := result.GetBody()
+	if err != nil {
+		t.Fatalf("failed to get body: %v", err)
+	}
+
+	clientSide, err := endpoint.GetOutput().SetBody(bodyBytes)
+	if err != nil {
+		t.Fatalf("failed to set body: %v", err)
+	}
+
+	expected := Drawing{Name: "d", Main: NewOneOf[Shape](&Square{Side: 4}), Others: []OneOf[Shape]{}}
+	if diff := cmp.Diff(expected, clientSide.(EndpointOutput[X, Drawing]).Body); diff != "" {
+		t.Fatalf("body mismatch:\n%s", diff)
+	}
+
+	var generic map[string]any
+	_ = json.Unmarshal(bodyBytes, &generic)
+	if generic["main"].(map[string]any)["kind"] != "square" {
+		t.Fatalf("expected discriminator in output, got %s", bodyBytes)
+	}
+}
+
+func TestOneOfMustBeWrapped(t *testing.T) {
+	type unwrapped struct {
+		Main Shape
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected a panic for a oneOf field not wrapped in OneOf")
+		}
+	}()
+	Endpoint[EndpointInput[X, X, X, unwrapped], EndpointOutput[X, X]]{Method: http.MethodPost}.validate(false)
+}
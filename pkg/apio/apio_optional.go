@@ -0,0 +1,127 @@
+package apio
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// Optional is a field that is either absent, null or set to a value, e.g. for
+// partial updates where null clears a value and absent leaves it unchanged.
+// Optional fields are never required. In bodies they must be tagged with
+// `json:",omitzero"`, so that absent fields are left out of JSON rather than
+// encoded as null. Query parameters and headers are absent or set, as they
+// have no null.
+type Optional[T any] struct {
+	value T
+	state optionalState
+}
+
+type optionalState uint8
+
+const (
+	optionalAbsent optionalState = iota
+	optionalNull
+	optionalSet
+)
+
+// Some returns an Optional set to value
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{value: value, state: optionalSet}
+}
+
+// Null returns an explicitly null Optional
+func Null[T any]() Optional[T] {
+	return Optional[T]{state: optionalNull}
+}
+
+// Absent returns an absent Optional, the zero value
+func Absent[T any]() Optional[T] {
+	return Optional[T]{}
+}
+
+func (o Optional[T]) IsAbsent() bool {
+	return o.state == optionalAbsent
+}
+
+func (o Optional[T]) IsNull() bool {
+	return o.state == optionalNull
+}
+
+func (o Optional[T]) IsSet() bool {
+	return o.state == optionalSet
+}
+
+// Get returns the value, and whether it is set
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.state == optionalSet
+}
+
+// OrElse returns the value if set, otherwise fallback
+func (o Optional[T]) OrElse(fallback T) T {
+	if o.state != optionalSet {
+		return fallback
+	}
+	return o.value
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if o.state != optionalSet {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*o = Null[T]()
+		return nil
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*o = Some(value)
+	return nil
+}
+
+func (o Optional[T]) optionalValueType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// optionalField lets us reflect on Optional of any value type
+type optionalField interface {
+	IsAbsent() bool
+	IsSet() bool
+	optionalValueType() reflect.Type
+}
+
+var optionalFieldType = reflect.TypeOf((*optionalField)(nil)).Elem()
+
+func isOptionalType(t reflect.Type) bool {
+	return t != nil && t.Kind() == reflect.Struct && t.Implements(optionalFieldType)
+}
+
+// OptionalValueType returns T of an Optional[T] type
+func OptionalValueType(t reflect.Type) (reflect.Type, bool) {
+	if !isOptionalType(t) {
+		return nil, false
+	}
+	return reflect.Zero(t).Interface().(optionalField).optionalValueType(), true
+}
+
+// IsNullable returns true for Optional fields, which may be explicitly null
+func (a *FieldInfo) IsNullable() bool {
+	return isOptionalType(a.Type)
+}
+
+// isAbsentOptional returns true for absent Optional values, left out of JSON
+func isAbsentOptional(v reflect.Value) bool {
+	return isOptionalType(v.Type()) && v.Interface().(optionalField).IsAbsent()
+}
+
+// isUnsetOptional returns true for absent or null Optional values, which are
+// left out of query parameters and headers
+func isUnsetOptional(v reflect.Value) bool {
+	return isOptionalType(v.Type()) && !v.Interface().(optionalField).IsSet()
+}
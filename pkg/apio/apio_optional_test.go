@@ -0,0 +1,150 @@
+package apio
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type userPatch struct {
+	Name  Optional[string] `json:",omitzero"`
+	Email Optional[string] `json:",omitzero"`
+	Age   Optional[int]    `json:",omitzero"`
+}
+
+type patchHeaders struct {
+	IfMatch Optional[string] `name:"If-Match"`
+}
+
+type patchQuery struct {
+	DryRun Optional[bool]
+}
+
+type patchResult struct {
+	Changes map[string]string
+	IfMatch string
+	DryRun  bool
+}
+
+func describeOptional[T any](o Optional[T]) string {
+	switch {
+	case o.IsAbsent():
+		return "absent"
+	case o.IsNull():
+		return "null"
+	default:
+		return "set"
+	}
+}
+
+type patchInput = EndpointInput[patchHeaders, recordsPath, patchQuery, userPatch]
+type patchOutput = EndpointOutput[X, patchResult]
+
+var patchEndpoint = Endpoint[patchInput, patchOutput]{
+	Method: http.MethodPatch,
+	Handler: func(input patchInput) (patchOutput, error) {
+		return BodyResponse(patchResult{
+			Changes: map[string]string{
+				"Name":  describeOptional(input.Body.Name),
+				"Email": describeOptional(input.Body.Email),
+				"Age":   describeOptional(input.Body.Age),
+			},
+			IfMatch: input.Headers.IfMatch.OrElse("*"),
+			DryRun:  input.Query.DryRun.OrElse(false),
+		}), nil
+	},
+}
+
+func TestOptionalJson(t *testing.T) {
+	patch := userPatch{Name: Some("bob"), Email: Null[string]()}
+	data, err := JsonCodec.Marshal(patch)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if diff := cmp.Diff(`{"Name":"bob","Email":null}`, string(data)); diff != "" {
+		t.Fatalf("unexpected json (-want +got):\n%s", diff)
+	}
+	if direct := must(json.Marshal(patch)); string(direct) != string(data) {
+		t.Fatalf("expected encoding/json to encode like the codec, got %s", direct)
+	}
+
+	var decoded userPatch
+	if err := JsonCodec.Unmarshal([]byte(`{"Name":"bob","Email":null}`), &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if name, ok := decoded.Name.Get(); !ok || name != "bob" {
+		t.Fatalf("expected name bob, got %v", decoded.Name)
+	}
+	if !decoded.Email.IsNull() || !decoded.Age.IsAbsent() {
+		t.Fatalf("expected a null email and an absent age, got %+v", decoded)
+	}
+
+	if err := JsonCodec.Unmarshal([]byte(`{"Age":"old"}`), &decoded); err == nil {
+		t.Fatalf("expected an error for an invalid value")
+	}
+}
+
+func TestOptionalBodyFieldsMustOmitZero(t *testing.T) {
+	type untaggedPatch struct {
+		Nested struct {
+			Name Optional[string]
+		}
+	}
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "omitzero") {
+			t.Fatalf("expected a panic about the missing omitzero tag, got %v", r)
+		}
+	}()
+	Endpoint[EndpointInput[X, recordsPath, X, untaggedPatch], EndpointOutput[X, X]]{Method: http.MethodPatch}.validate(false)
+}
+
+func TestOptionalFields(t *testing.T) {
+	info, err := GetStructInfo(userPatch{})
+	if err != nil {
+		t.Fatalf("failed to analyze struct: %v", err)
+	}
+	age := info.FieldsByName["Age"]
+	if age.IsRequired() || !age.IsNullable() || age.ValueType.Kind() != reflect.Int {
+		t.Fatalf("expected an optional nullable int field, got %s", age.String())
+	}
+}
+
+func TestOptionalEndpoint(t *testing.T) {
+	api := Api{Name: "patch"}.WithEndpoints(patchEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	client := patchEndpoint
+	client.Handler = nil
+	for _, test := range []struct {
+		input    patchInput
+		expected patchResult
+	}{
+		{
+			input: NewInput(patchHeaders{}, recordsPath{}, patchQuery{}, userPatch{Name: Some("bob"), Email: Null[string]()}),
+			expected: patchResult{
+				Changes: map[string]string{"Name": "set", "Email": "null", "Age": "absent"},
+				IfMatch: "*",
+			},
+		},
+		{
+			input: NewInput(patchHeaders{IfMatch: Some("v2")}, recordsPath{}, patchQuery{DryRun: Some(true)}, userPatch{Age: Some(0)}),
+			expected: patchResult{
+				Changes: map[string]string{"Name": "absent", "Email": "absent", "Age": "set"},
+				IfMatch: "v2",
+				DryRun:  true,
+			},
+		},
+	} {
+		output, err := client.RPC(server, test.input, DefaultOpts())
+		if err != nil {
+			t.Fatalf("failed to call endpoint: %v", err)
+		}
+		if diff := cmp.Diff(test.expected, output.Body); diff != "" {
+			t.Fatalf("unexpected result (-want +got):\n%s", diff)
+		}
+	}
+}
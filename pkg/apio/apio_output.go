@@ -1,11 +1,9 @@
 package apio
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
-	"strings"
 )
 
 type OutputPayload struct {
@@ -15,16 +13,32 @@ type OutputPayload struct {
 
 type EndpointOutputBase interface {
 	GetHeaders() map[string][]string
+	EncodeHeaders() (map[string][]string, error)
 	GetBody() ([]byte, error)
+	GetBodyAs(codec Codec) ([]byte, error)
 	ToPayload() (OutputPayload, error)
 	validateBodyType()
 	validateHeadersType()
 	SetBody(jsonBytes []byte) (EndpointOutputBase, error)
+	SetBodyAs(codec Codec, bodyBytes []byte) (EndpointOutputBase, error)
 	SetHeaders(hdrs map[string][]string) (EndpointOutputBase, error)
 	SetAll(hdrs map[string][]string, jsonBodyBytes []byte) (EndpointOutputBase, error)
 	GetBodyInfo() StructInfo
+	GetHeadersInfo() StructInfo
 	GetDescription() string
 	OkCode() int
+	// GetStream returns the body if it is a Stream
+	GetStream() (Stream, bool)
+	// isStreamed returns true if the body is read from the response as it arrives
+	isStreamed() bool
+	// GetHandler returns the body if it writes the response itself, e.g. a Stream
+	GetHandler() (http.Handler, bool)
+	withStream(stream Stream) EndpointOutputBase
+	getBody() any
+}
+
+func (e EndpointOutput[HeadersType, BodyType]) getBody() any {
+	return e.Body
 }
 
 func (e EndpointOutput[HeadersType, BodyType]) GetDescription() string {
@@ -39,6 +53,14 @@ func (e EndpointOutput[HeadersType, BodyType]) GetBodyInfo() StructInfo {
 	return info
 }
 
+func (e EndpointOutput[HeadersType, BodyType]) GetHeadersInfo() StructInfo {
+	info, err := GetStructInfo(e.Headers)
+	if err != nil {
+		panic(fmt.Sprintf("failed to analyze struct: %v", err))
+	}
+	return info
+}
+
 func (e EndpointOutput[HeadersType, BodyType]) OkCode() int {
 	bodyInfo, err := GetStructInfo(e.Body)
 	if err != nil {
@@ -52,6 +74,10 @@ func (e EndpointOutput[HeadersType, BodyType]) OkCode() int {
 }
 
 func (e EndpointOutput[HeadersType, BodyType]) SetBody(jsonBytes []byte) (EndpointOutputBase, error) {
+	return e.SetBodyAs(JsonCodec, jsonBytes)
+}
+
+func (e EndpointOutput[HeadersType, BodyType]) SetBodyAs(codec Codec, bodyBytes []byte) (EndpointOutputBase, error) {
 
 	// if target has no fields, just return
 	structInfo := e.GetBodyInfo()
@@ -59,27 +85,43 @@ func (e EndpointOutput[HeadersType, BodyType]) SetBody(jsonBytes []byte) (Endpoi
 		return e, nil
 	}
 
+	if _, isStream := e.GetStream(); isStream {
+		return e.withStream(bytesStream(codec.MediaType, bodyBytes)), nil
+	}
+
 	var res BodyType
-	err := json.Unmarshal(jsonBytes, &res)
+	err := codec.Unmarshal(bodyBytes, &res)
 	if err != nil {
-		return e, fmt.Errorf("failed to unmarshal body: %w", err)
+		return e, fmt.Errorf("failed to unmarshal %s body: %w", codec.MediaType, err)
 	}
 	e.Body = res
 	return e, nil
 }
 
-func (e EndpointOutput[HeadersType, BodyType]) SetAll(hdrs map[string][]string, jsonBodyBytes []byte) (EndpointOutputBase, error) {
+// SetAll sets headers and body, decoding the body according to the Content-Type header (JSON if missing)
+func (e EndpointOutput[HeadersType, BodyType]) SetAll(hdrs map[string][]string, bodyBytes []byte) (EndpointOutputBase, error) {
+	codec := JsonCodec
+	if contentType := headerValue(hdrs, "Content-Type"); contentType != "" {
+		var ok bool
+		if codec, ok = GetCodec(contentType); !ok {
+			return e, fmt.Errorf("no codec for response content type '%s'", contentType)
+		}
+	}
 	res, err := e.SetHeaders(hdrs)
 	if err != nil {
 		return res, fmt.Errorf("failed to set headers: %w", err)
 	}
-	res, err = res.SetBody(jsonBodyBytes)
+	res, err = res.SetBodyAs(codec, bodyBytes)
 	if err != nil {
 		return res, fmt.Errorf("failed to set body: %w", err)
 	}
 	return res, nil
 }
 
+// SetHeaders decodes the headers like input headers, matching them by their
+// kebab case name (or the field name). Slice fields collect the elements of
+// list headers, repeated or comma separated, and are optional like pointer
+// fields.
 func (e EndpointOutput[HeadersType, BodyType]) SetHeaders(hdrs map[string][]string) (EndpointOutputBase, error) {
 
 	// Check that it is a struct
@@ -88,43 +130,35 @@ func (e EndpointOutput[HeadersType, BodyType]) SetHeaders(hdrs map[string][]stri
 		panic(fmt.Errorf("failed to analyze headers struct: %w", err))
 	}
 
-	requiredNotSet := make(map[string]bool)
+	rootStructValue := reflect.ValueOf(&e.Headers).Elem()
 	for _, field := range structInfo.Fields {
-		if field.IsRequired() {
-			requiredNotSet[field.LKName] = true
+		if !field.HasFieldNameInStruct() || isCookieOutputType(field.Type) {
+			continue // cookies are set below
 		}
-	}
 
-	// Check that all headers are present
-	for k, vs := range hdrs {
-		for _, v := range vs {
-			lkName := strings.ToLower(k)
-			field, exists := structInfo.FieldsByLKName[lkName]
-			if !exists {
-				continue // ignore extra headers
-			}
+		values := headerValues(hdrs, field.LKName)
+		if len(values) == 0 {
+			values = headerValues(hdrs, field.Name)
+		}
 
-			parser, err := getStringParsePtrFn(field.Type)
-			if err != nil {
-				return e, fmt.Errorf("failed to get parser for header '%s': %w", k, err)
+		target := rootStructValue.Field(field.Index)
+		if field.IsHeaderList() {
+			if err := getFromStringListHeaderFieldSetter(field.StructField, field.Name)(target, values); err != nil {
+				return e, fmt.Errorf("failed to set header '%s': %w", field.Name, err)
 			}
-			newValuePtr, err := parser(v)
-			if err != nil {
-				return e, fmt.Errorf("failed to parse header '%s': %w", k, err)
-			}
-			// assign the value to the struct field
-			// Check if it is a pointer first, in which case we need to set it using an address
-			if reflect.ValueOf(e.Headers).Field(field.Index).Kind() == reflect.Ptr {
-				reflect.ValueOf(&e.Headers).Elem().Field(field.Index).Set(reflect.ValueOf(newValuePtr))
-			} else {
-				reflect.ValueOf(&e.Headers).Elem().Field(field.Index).Set(reflect.ValueOf(newValuePtr).Elem())
-			}
-			delete(requiredNotSet, lkName)
+			continue
+		}
+		var value *string
+		if len(values) > 0 {
+			value = &values[0]
+		}
+		if err := getFromStringHeaderFieldSetter(field.StructField, field.Name)(target, value); err != nil {
+			return e, fmt.Errorf("failed to set header '%s': %w", field.Name, err)
 		}
 	}
 
-	if len(requiredNotSet) > 0 {
-		return e, fmt.Errorf("required headers not set: %v", requiredNotSet)
+	if err := setOutputCookies(structInfo, rootStructValue, hdrs); err != nil {
+		return e, err
 	}
 
 	return e, nil
@@ -135,13 +169,29 @@ func (e EndpointOutput[HeadersType, BodyType]) ToPayload() (OutputPayload, error
 	if err != nil {
 		return OutputPayload{}, fmt.Errorf("failed to get body: %w", err)
 	}
+	headers, err := e.EncodeHeaders()
+	if err != nil {
+		return OutputPayload{}, fmt.Errorf("failed to get headers: %w", err)
+	}
 	return OutputPayload{
-		Headers: e.GetHeaders(),
+		Headers: headers,
 		Body:    bodyBytes,
 	}, nil
 }
 
+// GetHeaders is EncodeHeaders for headers known to be encodable, it panics otherwise
 func (e EndpointOutput[HeadersType, BodyType]) GetHeaders() map[string][]string {
+	result, err := e.EncodeHeaders()
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// EncodeHeaders encodes the headers like input headers. Nil pointers are left
+// out, and slices are sent as one header per element, quoted if needed to
+// be read back as a list.
+func (e EndpointOutput[HeadersType, BodyType]) EncodeHeaders() (map[string][]string, error) {
 	result := make(map[string][]string)
 
 	// Check that it is a struct
@@ -150,22 +200,37 @@ func (e EndpointOutput[HeadersType, BodyType]) GetHeaders() map[string][]string
 		panic(fmt.Errorf("expected output headers to be a struct, got %s", headersType.Kind()))
 	}
 
-	numFields := headersType.NumField()
-	for i := 0; i < numFields; i++ {
-		field := headersType.Field(i)
-		if field.Name != "_" {
-			name := field.Name
-			if nameOvrd, ok := field.Tag.Lookup("name"); ok {
-				name = nameOvrd
+	structInfo, err := GetStructInfo(e.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze headers struct: %w", err)
+	}
+	for _, field := range structInfo.Fields {
+		value := reflect.ValueOf(e.Headers).Field(field.Index)
+		if isCookieOutputType(field.Type) {
+			result["Set-Cookie"] = append(result["Set-Cookie"], setCookieValues(field, value)...)
+		} else if field.HasFieldNameInStruct() {
+			values, err := encodeHeaderValues(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode header '%s': %w", field.Name, err)
+			}
+			if len(values) > 0 {
+				result[field.Name] = values
 			}
-			result[name] = []string{fmt.Sprintf("%v", reflect.ValueOf(e.Headers).Field(i).Interface())}
 		}
 	}
 
-	return result
+	return result, nil
 }
 
 func (e EndpointOutput[HeadersType, BodyType]) GetBody() ([]byte, error) {
+	return e.GetBodyAs(JsonCodec)
+}
+
+// GetBodyAs encodes the body with the codec. Stream bodies are read as is.
+func (e EndpointOutput[HeadersType, BodyType]) GetBodyAs(codec Codec) ([]byte, error) {
+	if stream, isStream := e.GetStream(); isStream {
+		return readStream(stream)
+	}
 	structInfo, err := GetStructInfo(e.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to analyze struct: %w", err)
@@ -173,9 +238,9 @@ func (e EndpointOutput[HeadersType, BodyType]) GetBody() ([]byte, error) {
 	if len(structInfo.Fields) == 0 {
 		return []byte{}, nil
 	}
-	bytes, err := json.Marshal(e.Body)
+	bytes, err := codec.Marshal(e.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal body: %w", err)
+		return nil, fmt.Errorf("failed to marshal %s body: %w", codec.MediaType, err)
 	}
 	return bytes, nil
 }
@@ -185,6 +250,7 @@ func (e EndpointOutput[HeadersType, BodyType]) validateBodyType() {
 	if bodyT.Kind() != reflect.Struct && bodyT.Kind() != reflect.Slice {
 		panic("BodyType must be a struct or slice")
 	}
+	validateJsonBodyType(bodyT, map[reflect.Type]bool{})
 }
 
 func (e EndpointOutput[HeadersType, BodyType]) validateHeadersType() {
@@ -193,3 +259,24 @@ func (e EndpointOutput[HeadersType, BodyType]) validateHeadersType() {
 		panic("HeadersType must be a struct")
 	}
 }
+
+// encodeHeaderValues serializes a header field like input headers
+func encodeHeaderValues(value reflect.Value) ([]string, error) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+	if isUnsetOptional(value) {
+		return nil, nil
+	}
+	if isHeaderSlice(value.Type()) {
+		return headerListValues(value)
+	}
+	str, err := serializeUrlValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{str}, nil
+}
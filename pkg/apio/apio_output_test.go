@@ -0,0 +1,134 @@
+package apio
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type pageHeaders struct {
+	Total int      `name:"X-Total"`
+	Next  *string  `name:"X-Next"`
+	Links []string `name:"Link"`
+}
+
+type pagedInput = EndpointInput[X, recordsPath, pageQuery, X]
+type pagedOutput = EndpointOutput[pageHeaders, X]
+
+var pagedEndpoint = Endpoint[pagedInput, pagedOutput]{
+	Method: http.MethodGet,
+	Handler: func(input pagedInput) (pagedOutput, error) {
+		headers := pageHeaders{Total: input.Query.PageSize}
+		if input.Query.SortBy != nil {
+			headers.Next = input.Query.SortBy
+			headers.Links = []string{"</records?page=2>; rel=next", "</records?page=9>; rel=last"}
+		}
+		return pagedOutput{Headers: headers}, nil
+	},
+}
+
+func TestOutputHeaders(t *testing.T) {
+	api := Api{Name: "headers"}.WithEndpoints(pagedEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	resp, err := http.Get(requestUrl(server, InputPayload{PathStr: "/records"}) + "?PageSize=3")
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.Header.Get("X-Total") != "3" {
+		t.Fatalf("expected X-Total 3, got %v", resp.Header.Values("X-Total"))
+	}
+	if _, ok := resp.Header["X-Next"]; ok {
+		t.Fatalf("expected no X-Next header for a nil pointer, got %v", resp.Header.Values("X-Next"))
+	}
+
+	resp, err = http.Get(requestUrl(server, InputPayload{PathStr: "/records"}) + "?PageSize=3&order=abc")
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.Header.Get("X-Next") != "abc" {
+		t.Fatalf("expected X-Next abc, got %v", resp.Header.Values("X-Next"))
+	}
+	if diff := cmp.Diff([]string{"</records?page=2>; rel=next", "</records?page=9>; rel=last"}, resp.Header.Values("Link")); diff != "" {
+		t.Fatalf("unexpected Link headers (-want +got):\n%s", diff)
+	}
+
+	client := pagedEndpoint
+	client.Handler = nil
+	next := "abc"
+	for _, query := range []pageQuery{{PageSize: 3}, {PageSize: 4, SortBy: &next}} {
+		output, err := client.RPC(server, NewInput(Empty, recordsPath{}, query, Empty), DefaultOpts())
+		if err != nil {
+			t.Fatalf("failed to call endpoint: %v", err)
+		}
+		expected, _ := pagedEndpoint.Handler(NewInput(Empty, recordsPath{}, query, Empty))
+		if diff := cmp.Diff(expected.Headers, output.Headers); diff != "" {
+			t.Fatalf("unexpected headers (-want +got):\n%s", diff)
+		}
+	}
+
+	if _, err := (pagedOutput{}).SetHeaders(map[string][]string{"Link": {"x"}}); err == nil {
+		t.Fatalf("expected an error for a missing required header")
+	}
+}
+
+func TestOutputListHeadersRoundTrip(t *testing.T) {
+	links := []string{"a, b", `say "hi"`, "c"}
+	output := pagedOutput{Headers: pageHeaders{Total: 1, Links: links}}
+	headers := must(output.EncodeHeaders())
+	if diff := cmp.Diff([]string{`"a, b"`, `"say \\\"hi\\\""`, "c"}, headers["Link"]); diff != "" {
+		t.Fatalf("unexpected encoded headers (-want +got):\n%s", diff)
+	}
+
+	decoded := must(pagedOutput{}.SetHeaders(headers)).(pagedOutput)
+	if diff := cmp.Diff(links, decoded.Headers.Links); diff != "" {
+		t.Fatalf("unexpected decoded headers (-want +got):\n%s", diff)
+	}
+
+	// e.g. by a proxy merging the repeated header lines
+	headers["Link"] = []string{strings.Join(headers["Link"], ", ")}
+	merged := must(pagedOutput{}.SetHeaders(headers)).(pagedOutput)
+	if diff := cmp.Diff(links, merged.Headers.Links); diff != "" {
+		t.Fatalf("unexpected merged headers (-want +got):\n%s", diff)
+	}
+}
+
+type tracedHeaders struct {
+	RequestId  string
+	RetryCount *int
+	ItemTags   []string
+}
+
+func TestOutputHeadersByKebabCaseName(t *testing.T) {
+	endpoint := Endpoint[EndpointInput[X, recordsPath, X, X], EndpointOutput[tracedHeaders, X]]{Method: http.MethodGet}
+
+	// e.g. a server not using apio, sending the header names in kebab case
+	echoServer := echo.New()
+	echoServer.GET("/records", func(c echo.Context) error {
+		c.Response().Header()["request-id"] = []string{"abc"}
+		c.Response().Header()["retry-count"] = []string{"2"}
+		c.Response().Header()["item-tags"] = []string{"a, b"}
+		return c.JSON(http.StatusOK, struct{}{})
+	})
+	httpServer := httptest.NewServer(echoServer)
+	t.Cleanup(httpServer.Close)
+	serverUrl, _ := url.Parse(httpServer.URL)
+	port, _ := strconv.Atoi(serverUrl.Port())
+	server := Server{Scheme: "http", Host: serverUrl.Hostname(), Port: port}
+
+	output, err := endpoint.RPC(server, NewInput(Empty, recordsPath{}, Empty, Empty), DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	retries := 2
+	if diff := cmp.Diff(tracedHeaders{RequestId: "abc", RetryCount: &retries, ItemTags: []string{"a", "b"}}, output.Headers); diff != "" {
+		t.Fatalf("unexpected headers (-want +got):\n%s", diff)
+	}
+}
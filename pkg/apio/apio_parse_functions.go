@@ -3,13 +3,17 @@ package apio
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"reflect"
+	"regexp"
 )
 
 type pathFieldSetter = func(target reflect.Value, from string) error
 
 type queryFieldSetter = func(target reflect.Value, from *string) error
 type headerFieldSetter = func(target reflect.Value, from *string) error
+type headerListFieldSetter = func(target reflect.Value, from []string) error
+type cookieFieldSetter = func(target reflect.Value, from *string) error
 
 func getFromStringPathFieldSetter(field reflect.StructField) pathFieldSetter {
 	parseFn, err := getStringParsePtrFn(field.Type)
@@ -27,18 +31,36 @@ func getFromStringPathFieldSetter(field reflect.StructField) pathFieldSetter {
 	}
 }
 
-func getFromStringQueryFieldSetter(field reflect.StructField) queryFieldSetter {
+// getPatternPathFieldSetter rejects values that don't fully match the field's
+// pattern with 404, as paths that don't match any route
+func getPatternPathFieldSetter(field FieldInfo, setter pathFieldSetter) pathFieldSetter {
+	if field.Pattern == "" {
+		return setter
+	}
+	pattern, err := regexp.Compile("^(?:" + field.Pattern + ")$")
+	if err != nil {
+		panic(fmt.Errorf("invalid pattern for path parameter '%s': %w", field.Name, err))
+	}
+	return func(target reflect.Value, from string) error {
+		if !pattern.MatchString(from) {
+			return NewError(http.StatusNotFound, fmt.Sprintf("path parameter '%s' does not match pattern '%s'", field.Name, field.Pattern), nil)
+		}
+		return setter(target, from)
+	}
+}
+
+func getFromStringQueryFieldSetter(field reflect.StructField, name string) queryFieldSetter {
 	parseFn, err := getStringParsePtrFn(field.Type)
 	if err != nil {
-		panic(fmt.Errorf("failed to get parse function for field '%s': %w", field.Name, err))
+		panic(fmt.Errorf("failed to get parse function for field '%s': %w", name, err))
 	}
 
 	return func(target reflect.Value, from *string) error {
 
 		if from == nil {
-			// Check that target is a pointer (=optional)
-			if target.Kind() != reflect.Ptr {
-				return fmt.Errorf("missing required parameter '%s'", field.Name)
+			// Check that target is a pointer or Optional (=optional)
+			if target.Kind() != reflect.Ptr && !isOptionalType(target.Type()) {
+				return fmt.Errorf("missing required parameter '%s'", name)
 			} else {
 				// Leave the target at nil/zero/unset
 				return nil
@@ -47,7 +69,7 @@ func getFromStringQueryFieldSetter(field reflect.StructField) queryFieldSetter {
 
 		parsedPtr, err := parseFn(*from)
 		if err != nil {
-			return fmt.Errorf("failed to parse '%s' into field %s [%t]: %w", *from, field.Name, field.Type, err)
+			return fmt.Errorf("failed to parse '%s' into field %s [%t]: %w", *from, name, field.Type, err)
 		}
 		if target.Kind() == reflect.Ptr {
 			target.Set(reflect.ValueOf(parsedPtr))
@@ -67,8 +89,8 @@ func getFromStringHeaderFieldSetter(field reflect.StructField, name string) quer
 	return func(target reflect.Value, from *string) error {
 
 		if from == nil {
-			// Check that target is a pointer (=optional)
-			if target.Kind() != reflect.Ptr {
+			// Check that target is a pointer or Optional (=optional)
+			if target.Kind() != reflect.Ptr && !isOptionalType(target.Type()) {
 				return fmt.Errorf("missing required header parameter '%s'", name)
 			} else {
 				// Leave the target at nil/zero/unset
@@ -89,6 +111,67 @@ func getFromStringHeaderFieldSetter(field reflect.StructField, name string) quer
 	}
 }
 
+// getFromStringListHeaderFieldSetter collects repeated headers and comma
+// separated values into a slice. Absent headers leave the slice nil.
+func getFromStringListHeaderFieldSetter(field reflect.StructField, name string) headerListFieldSetter {
+	parseFn, err := getStringParsePtrFn(field.Type.Elem())
+	if err != nil {
+		panic(fmt.Errorf("failed to get parse function for field '%s': %w", name, err))
+	}
+
+	return func(target reflect.Value, from []string) error {
+		values := splitHeaderList(from)
+		if len(values) == 0 {
+			return nil
+		}
+		result := reflect.MakeSlice(field.Type, len(values), len(values))
+		for i, value := range values {
+			parsedPtr, err := parseFn(value)
+			if err != nil {
+				return fmt.Errorf("failed to parse '%s' into field %s [%t]: %w", value, name, field.Type, err)
+			}
+			if field.Type.Elem().Kind() == reflect.Ptr {
+				result.Index(i).Set(reflect.ValueOf(parsedPtr))
+			} else {
+				result.Index(i).Set(reflect.ValueOf(parsedPtr).Elem())
+			}
+		}
+		target.Set(result)
+		return nil
+	}
+}
+
+func getFromStringCookieFieldSetter(field reflect.StructField, name string) cookieFieldSetter {
+	parseFn, err := getStringParsePtrFn(field.Type)
+	if err != nil {
+		panic(fmt.Errorf("failed to get parse function for cookie '%s': %w", name, err))
+	}
+
+	return func(target reflect.Value, from *string) error {
+
+		if from == nil {
+			// Check that target is a pointer or Optional (=optional)
+			if target.Kind() != reflect.Ptr && !isOptionalType(target.Type()) {
+				return fmt.Errorf("missing required cookie '%s'", name)
+			} else {
+				// Leave the target at nil/zero/unset
+				return nil
+			}
+		}
+
+		parsedPtr, err := parseFn(*from)
+		if err != nil {
+			return fmt.Errorf("failed to parse '%s' into cookie %s [%t]: %w", *from, name, field.Type, err)
+		}
+		if target.Kind() == reflect.Ptr {
+			target.Set(reflect.ValueOf(parsedPtr))
+		} else {
+			target.Set(reflect.ValueOf(parsedPtr).Elem())
+		}
+		return nil
+	}
+}
+
 func getStringParsePtrFn(tpe reflect.Type) (func(string) (any, error), error) {
 
 	// This is super silly. And we should probably optimize this a bit ;).
@@ -0,0 +1,643 @@
+package apio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MediaTypeMergePatch = "application/merge-patch+json"
+	MediaTypeJsonPatch  = "application/json-patch+json"
+)
+
+var MergePatchCodec = Codec{MediaType: MediaTypeMergePatch, Marshal: json.Marshal, Unmarshal: json.Unmarshal}
+var JsonPatchCodec = Codec{MediaType: MediaTypeJsonPatch, Marshal: json.Marshal, Unmarshal: json.Unmarshal}
+
+// patchBody is implemented by MergePatch and JSONPatch. They are consumed as
+// their own media type, and analyzed and documented like their schema type.
+type patchBody interface {
+	patchMediaType() string
+	patchSchemaType() reflect.Type
+}
+
+var patchBodyType = reflect.TypeOf((*patchBody)(nil)).Elem()
+
+func isPatchType(t reflect.Type) bool {
+	return t != nil && t.Implements(patchBodyType)
+}
+
+func patchBodyOf(t reflect.Type) patchBody {
+	return reflect.Zero(t).Interface().(patchBody)
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+///// JSON MERGE PATCH
+
+// MergePatch is a JSON Merge Patch (RFC 7396) of a T: an object with the
+// fields to change, where null removes a field. Its keys are validated
+// against the json fields of T when decoded.
+type MergePatch[T any] struct {
+	doc json.RawMessage
+}
+
+// NewMergePatch returns the merge patch of a patch document, e.g. a map or a
+// struct with Optional fields
+func NewMergePatch[T any](patch any) (MergePatch[T], error) {
+	doc, err := json.Marshal(patch)
+	if err != nil {
+		return MergePatch[T]{}, fmt.Errorf("failed to marshal merge patch: %w", err)
+	}
+	var result MergePatch[T]
+	if err := result.UnmarshalJSON(doc); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Document returns the patch document
+func (p MergePatch[T]) Document() json.RawMessage {
+	return p.doc
+}
+
+// Apply returns current with the patch applied. It fails with 422 if the
+// patched document is not a valid T.
+func (p MergePatch[T]) Apply(current T) (T, error) {
+	var result T
+	target, err := toJsonDoc(current)
+	if err != nil {
+		return result, err
+	}
+	patch, err := decodeJsonDoc(p.doc)
+	if err != nil {
+		return result, err
+	}
+	return fromJsonDoc[T](mergePatch(target, patch))
+}
+
+func (p MergePatch[T]) MarshalJSON() ([]byte, error) {
+	if len(p.doc) == 0 {
+		return []byte("{}"), nil
+	}
+	return p.doc, nil
+}
+
+func (p *MergePatch[T]) UnmarshalJSON(data []byte) error {
+	patch, err := decodeJsonDoc(data)
+	if err != nil {
+		return err
+	}
+	if _, isObject := patch.(map[string]any); !isObject {
+		return fmt.Errorf("merge patch must be a json object")
+	}
+	if err := validateMergePatch(reflect.TypeOf((*T)(nil)).Elem(), patch, ""); err != nil {
+		return err
+	}
+	p.doc = bytes.Clone(data)
+	return nil
+}
+
+func (p MergePatch[T]) patchMediaType() string {
+	return MediaTypeMergePatch
+}
+
+func (p MergePatch[T]) patchSchemaType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// mergePatch applies a merge patch to a generic json document, as in RFC 7396
+func mergePatch(target any, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+		} else {
+			targetObj[k] = mergePatch(targetObj[k], v)
+		}
+	}
+	return targetObj
+}
+
+// validateMergePatch checks that the keys of patch objects are fields of t
+func validateMergePatch(t reflect.Type, patch any, path string) error {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return nil // values are checked when applied
+	}
+	t = jsonValueType(t)
+	for k, v := range patchObj {
+		childT, ok := jsonChildType(t, k)
+		if !ok {
+			return fmt.Errorf("unknown field '%s' in merge patch of %v", path+"/"+k, t)
+		}
+		if childT == nil || v == nil {
+			continue
+		}
+		if err := validateMergePatch(childT, v, path+"/"+k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+///// JSON PATCH
+
+// JSONPatchOperation is an operation of a JSON Patch. Paths and from are
+// JSON pointers, e.g. "/tags/0". Values are kept as raw json, so that
+// numbers stay exact.
+type JSONPatchOperation struct {
+	Op    string                    `json:"op"`
+	Path  string                    `json:"path"`
+	From  string                    `json:"from,omitempty"`
+	Value Optional[json.RawMessage] `json:"value,omitzero"`
+}
+
+// JSONPatch is a JSON Patch (RFC 6902) of a T: a list of operations. Their
+// paths are validated against the json fields of T when decoded.
+type JSONPatch[T any] struct {
+	ops []JSONPatchOperation
+}
+
+// NewJSONPatch returns the patch of the operations
+func NewJSONPatch[T any](ops ...JSONPatchOperation) (JSONPatch[T], error) {
+	result := JSONPatch[T]{ops: ops}
+	return result, result.validate()
+}
+
+// Operations returns the operations of the patch
+func (p JSONPatch[T]) Operations() []JSONPatchOperation {
+	return p.ops
+}
+
+// Apply returns current with the operations applied in order. It fails with
+// 422 if an operation can't be applied, including failed tests, or if the
+// patched document is not a valid T.
+func (p JSONPatch[T]) Apply(current T) (T, error) {
+	var result T
+	doc, err := toJsonDoc(current)
+	if err != nil {
+		return result, err
+	}
+	for i, op := range p.ops {
+		doc, err = applyJsonPatchOperation(doc, op)
+		if err != nil {
+			return result, NewError(http.StatusUnprocessableEntity, fmt.Sprintf("failed to apply operation %d (%s %s): %v", i, op.Op, op.Path, err), err)
+		}
+	}
+	return fromJsonDoc[T](doc)
+}
+
+func (p JSONPatch[T]) MarshalJSON() ([]byte, error) {
+	if p.ops == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(p.ops)
+}
+
+func (p *JSONPatch[T]) UnmarshalJSON(data []byte) error {
+	var ops []JSONPatchOperation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return fmt.Errorf("json patch must be an array of operations: %w", err)
+	}
+	p.ops = ops
+	return p.validate()
+}
+
+func (p JSONPatch[T]) patchMediaType() string {
+	return MediaTypeJsonPatch
+}
+
+func (p JSONPatch[T]) patchSchemaType() reflect.Type {
+	return reflect.TypeOf([]JSONPatchOperation{})
+}
+
+func (p JSONPatch[T]) validate() error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for i, op := range p.ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value.IsAbsent() {
+				return fmt.Errorf("operation %d (%s) requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if err := validateJsonPointer(t, op.From); err != nil {
+				return fmt.Errorf("invalid from of operation %d (%s): %w", i, op.Op, err)
+			}
+		case "remove":
+		default:
+			return fmt.Errorf("unknown op '%s' of operation %d", op.Op, i)
+		}
+		if err := validateJsonPointer(t, op.Path); err != nil {
+			return fmt.Errorf("invalid path of operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+	return nil
+}
+
+// validateJsonPointer checks that a pointer refers to a location within t
+func validateJsonPointer(t reflect.Type, pointer string) error {
+	tokens, err := jsonPointerTokens(pointer)
+	if err != nil {
+		return err
+	}
+	for i, token := range tokens {
+		t = jsonValueType(t)
+		if t == nil {
+			return nil // any value below an interface
+		}
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+			if _, err := strconv.Atoi(token); err != nil && !(token == "-" && i == len(tokens)-1) {
+				return fmt.Errorf("'%s' is not an index of %v", token, t)
+			}
+			t = t.Elem()
+		default:
+			childT, ok := jsonChildType(t, token)
+			if !ok {
+				return fmt.Errorf("unknown field '%s' of %v", token, t)
+			}
+			t = childT
+		}
+	}
+	return nil
+}
+
+func jsonPointerTokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("json pointer '%s' must start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func applyJsonPatchOperation(doc any, op JSONPatchOperation) (any, error) {
+	tokens, _ := jsonPointerTokens(op.Path)
+	switch op.Op {
+	case "add":
+		value, err := opValue(op)
+		if err != nil {
+			return doc, err
+		}
+		return jsonDocAdd(doc, tokens, value)
+	case "remove":
+		result, _, err := jsonDocRemove(doc, tokens)
+		return result, err
+	case "replace":
+		value, err := opValue(op)
+		if err != nil {
+			return doc, err
+		}
+		if _, err := jsonDocGet(doc, tokens); err != nil {
+			return doc, err
+		}
+		return jsonDocSet(doc, tokens, value)
+	case "move", "copy":
+		fromTokens, _ := jsonPointerTokens(op.From)
+		if op.Op == "move" && strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+			return doc, fmt.Errorf("can't move '%s' into itself", op.From)
+		}
+		value, err := jsonDocGet(doc, fromTokens)
+		if err != nil {
+			return doc, err
+		}
+		if op.Op == "move" {
+			if doc, _, err = jsonDocRemove(doc, fromTokens); err != nil {
+				return doc, err
+			}
+		} else if value, err = toJsonDoc(value); err != nil { // a deep copy
+			return doc, err
+		}
+		return jsonDocAdd(doc, tokens, value)
+	case "test":
+		value, err := opValue(op)
+		if err != nil {
+			return doc, err
+		}
+		actual, err := jsonDocGet(doc, tokens)
+		if err != nil {
+			return doc, err
+		}
+		if !jsonDocEqual(actual, value) {
+			return doc, fmt.Errorf("test failed, value at '%s' differs", op.Path)
+		}
+		return doc, nil
+	default:
+		return doc, fmt.Errorf("unknown op '%s'", op.Op)
+	}
+}
+
+func opValue(op JSONPatchOperation) (any, error) {
+	if op.Value.IsNull() {
+		return nil, nil
+	}
+	value, _ := op.Value.Get()
+	return decodeJsonDoc(value)
+}
+
+func jsonDocGet(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("no value at '%s'", token)
+			}
+			doc = value
+		case []any:
+			index, err := jsonArrayIndex(container, token, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("no value at '%s'", token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonDocAdd adds a value, replacing object members and inserting into arrays
+func jsonDocAdd(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := jsonDocGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return doc, err
+	}
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]any:
+		container[last] = value
+		return doc, nil
+	case []any:
+		index := len(container)
+		if last != "-" {
+			if index, err = jsonArrayIndex(container, last, true); err != nil {
+				return doc, err
+			}
+		}
+		updated := append(container[:index:index], append([]any{value}, container[index:]...)...)
+		return jsonDocSet(doc, tokens[:len(tokens)-1], updated)
+	default:
+		return doc, fmt.Errorf("can't add '%s' to a non-container value", last)
+	}
+}
+
+// jsonDocSet replaces an existing value
+func jsonDocSet(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := jsonDocGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return doc, err
+	}
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]any:
+		container[last] = value
+		return doc, nil
+	case []any:
+		index, err := jsonArrayIndex(container, last, false)
+		if err != nil {
+			return doc, err
+		}
+		container[index] = value
+		return doc, nil
+	default:
+		return doc, fmt.Errorf("no value at '%s'", last)
+	}
+}
+
+// jsonDocRemove removes a value, returning the updated document and the value
+func jsonDocRemove(doc any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := jsonDocGet(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return doc, nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]any:
+		value, ok := container[last]
+		if !ok {
+			return doc, nil, fmt.Errorf("no value at '%s'", last)
+		}
+		delete(container, last)
+		return doc, value, nil
+	case []any:
+		index, err := jsonArrayIndex(container, last, false)
+		if err != nil {
+			return doc, nil, err
+		}
+		value := container[index]
+		updated := append(container[:index:index], container[index+1:]...)
+		doc, err = jsonDocSet(doc, tokens[:len(tokens)-1], updated)
+		return doc, value, err
+	default:
+		return doc, nil, fmt.Errorf("no value at '%s'", last)
+	}
+}
+
+func jsonArrayIndex(array []any, token string, allowEnd bool) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	if index > len(array) || (index == len(array) && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of bounds", index)
+	}
+	return index, nil
+}
+
+// jsonDocEqual compares json documents, with numbers compared by value
+func jsonDocEqual(a any, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		aRat, okA := new(big.Rat).SetString(a.String())
+		bRat, okB := new(big.Rat).SetString(b.String())
+		return okA && okB && aRat.Cmp(bRat) == 0
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if other, ok := b[k]; !ok || !jsonDocEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonDocEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+///// GENERIC JSON DOCUMENTS
+
+// toJsonDoc converts a value into a generic json document, keeping numbers exact
+func toJsonDoc(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %T: %w", v, err)
+	}
+	return decodeJsonDoc(data)
+}
+
+func decodeJsonDoc(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var result any
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	return result, nil
+}
+
+func fromJsonDoc[T any](doc any) (T, error) {
+	var result T
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return result, fmt.Errorf("failed to marshal patched document: %w", err)
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, NewError(http.StatusUnprocessableEntity, fmt.Sprintf("patched document is not a valid %v: %v", reflect.TypeOf(result), err), err)
+	}
+	return result, nil
+}
+
+// jsonValueType unwraps pointers and Optional, and returns nil for interfaces
+// whose values can be anything
+func jsonValueType(t reflect.Type) reflect.Type {
+	for t != nil {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		} else if valueType, ok := OptionalValueType(t); ok {
+			t = valueType
+		} else if _, ok := OneOfInterfaceType(t); ok {
+			return nil
+		} else if t.Kind() == reflect.Interface {
+			return nil
+		} else {
+			return t
+		}
+	}
+	return nil
+}
+
+// jsonChildType returns the type of a member of a json object of type t. The
+// type is nil if anything goes, e.g. below interfaces.
+func jsonChildType(t reflect.Type, name string) (reflect.Type, bool) {
+	t = jsonValueType(t)
+	if t == nil {
+		return nil, true
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem(), t.Key().Kind() == reflect.String
+	case reflect.Struct:
+		if field, ok := jsonFieldOf(t, name); ok {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// jsonFieldOf finds the struct field of a json key, like encoding/json does,
+// including fields of embedded structs
+func jsonFieldOf(t reflect.Type, key string) (reflect.StructField, bool) {
+	var fallback *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isEmbeddedJsonStruct(field) {
+			embeddedT := field.Type
+			if embeddedT.Kind() == reflect.Pointer {
+				embeddedT = embeddedT.Elem()
+			}
+			if embedded, ok := jsonFieldOf(embeddedT, key); ok {
+				return embedded, true
+			}
+			continue
+		}
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		if name == key {
+			return field, true
+		}
+		if fallback == nil && strings.EqualFold(name, key) {
+			fallback = &field
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonFieldName returns the json key of a struct field, mirroring encoding/json
+func jsonFieldName(field reflect.StructField) (name string, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+		return "", true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// isEmbeddedJsonStruct returns true for embedded structs whose fields encoding/json promotes
+func isEmbeddedJsonStruct(field reflect.StructField) bool {
+	if !field.Anonymous {
+		return false
+	}
+	if name, _ := jsonFieldName(field); name != field.Name {
+		return false // explicitly named, so not promoted
+	}
+	t := field.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
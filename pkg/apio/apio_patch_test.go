@@ -0,0 +1,216 @@
+package apio
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type patchAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type patchUser struct {
+	Name    string       `json:"name"`
+	Email   *string      `json:"email"`
+	Tags    []string     `json:"tags"`
+	Address patchAddress `json:"address"`
+	Extra   map[string]int
+}
+
+func currentUser() patchUser {
+	email := "bob@example.com"
+	return patchUser{Name: "bob", Email: &email, Tags: []string{"a", "b"}, Address: patchAddress{City: "Bergen", Zip: "5003"}}
+}
+
+func TestMergePatch(t *testing.T) {
+	patch, err := NewMergePatch[patchUser](map[string]any{
+		"email":   nil,
+		"tags":    []string{"x"},
+		"address": map[string]any{"city": "Oslo"},
+		"Extra":   map[string]any{"n": 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to create merge patch: %v", err)
+	}
+	patched, err := patch.Apply(currentUser())
+	if err != nil {
+		t.Fatalf("failed to apply merge patch: %v", err)
+	}
+	expected := patchUser{Name: "bob", Tags: []string{"x"}, Address: patchAddress{City: "Oslo", Zip: "5003"}, Extra: map[string]int{"n": 1}}
+	if diff := cmp.Diff(expected, patched); diff != "" {
+		t.Fatalf("unexpected patched user (-want +got):\n%s", diff)
+	}
+
+	for _, doc := range []string{`{"nickname":"b"}`, `{"address":{"street":"x"}}`, `["name"]`} {
+		var invalid MergePatch[patchUser]
+		if err := JsonCodec.Unmarshal([]byte(doc), &invalid); err == nil {
+			t.Fatalf("expected an error for merge patch %s", doc)
+		}
+	}
+
+	invalidValue, err := NewMergePatch[patchUser](map[string]any{"name": 42})
+	if err != nil {
+		t.Fatalf("failed to create merge patch: %v", err)
+	}
+	var errResp *ErrResp
+	if _, err := invalidValue.Apply(currentUser()); !errors.As(err, &errResp) || errResp.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a 422 error for an invalid value, got %v", err)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	var patch JSONPatch[patchUser]
+	err := JsonCodec.Unmarshal([]byte(`[
+		{"op": "test", "path": "/name", "value": "bob"},
+		{"op": "replace", "path": "/name", "value": "alice"},
+		{"op": "add", "path": "/tags/-", "value": "c"},
+		{"op": "add", "path": "/tags/0", "value": "first"},
+		{"op": "remove", "path": "/tags/1"},
+		{"op": "copy", "from": "/address/city", "path": "/address/zip"},
+		{"op": "move", "from": "/tags/0", "path": "/tags/2"},
+		{"op": "add", "path": "/email", "value": null},
+		{"op": "add", "path": "/Extra", "value": {"a~/b": 1}},
+		{"op": "replace", "path": "/Extra/a~0~1b", "value": 2}
+	]`), &patch)
+	if err != nil {
+		t.Fatalf("failed to decode json patch: %v", err)
+	}
+	patched, err := patch.Apply(currentUser())
+	if err != nil {
+		t.Fatalf("failed to apply json patch: %v", err)
+	}
+	expected := patchUser{Name: "alice", Tags: []string{"b", "c", "first"}, Address: patchAddress{City: "Bergen", Zip: "Bergen"}, Extra: map[string]int{"a~/b": 2}}
+	if diff := cmp.Diff(expected, patched); diff != "" {
+		t.Fatalf("unexpected patched user (-want +got):\n%s", diff)
+	}
+
+	for _, doc := range []string{
+		`[{"op": "replace", "path": "/nickname", "value": "b"}]`,
+		`[{"op": "add", "path": "/tags/first", "value": "b"}]`,
+		`[{"op": "add", "path": "/name"}]`,
+		`[{"op": "rename", "path": "/name"}]`,
+		`[{"op": "move", "from": "/missing", "path": "/name"}]`,
+		`{"op": "remove", "path": "/name"}`,
+	} {
+		var invalid JSONPatch[patchUser]
+		if err := JsonCodec.Unmarshal([]byte(doc), &invalid); err == nil {
+			t.Fatalf("expected an error for json patch %s", doc)
+		}
+	}
+
+	for _, op := range []JSONPatchOperation{
+		{Op: "test", Path: "/name", Value: Some(json.RawMessage(`"alice"`))},
+		{Op: "remove", Path: "/tags/5"},
+		{Op: "replace", Path: "/Extra/missing", Value: Some(json.RawMessage(`1`))},
+	} {
+		failing, err := NewJSONPatch[patchUser](op)
+		if err != nil {
+			t.Fatalf("failed to create json patch: %v", err)
+		}
+		var errResp *ErrResp
+		if _, err := failing.Apply(currentUser()); !errors.As(err, &errResp) || errResp.Status != http.StatusUnprocessableEntity {
+			t.Fatalf("expected a 422 error for %+v, got %v", op, err)
+		}
+	}
+}
+
+type patchCounter struct {
+	Count int64 `json:"count"`
+}
+
+func TestJSONPatchKeepsLargeNumbers(t *testing.T) {
+	var patch JSONPatch[patchCounter]
+	doc := `[{"op": "replace", "path": "/count", "value": 9007199254740993}, {"op": "test", "path": "/count", "value": 9007199254740993}]`
+	if err := JsonCodec.Unmarshal([]byte(doc), &patch); err != nil {
+		t.Fatalf("failed to decode json patch: %v", err)
+	}
+	patched, err := patch.Apply(patchCounter{Count: 1})
+	if err != nil {
+		t.Fatalf("failed to apply json patch: %v", err)
+	}
+	if patched.Count != 9007199254740993 {
+		t.Fatalf("expected the exact count, got %d", patched.Count)
+	}
+
+	rounded := must(NewJSONPatch[patchCounter](JSONPatchOperation{Op: "test", Path: "/count", Value: Some(json.RawMessage(`9007199254740992`))}))
+	if _, err := rounded.Apply(patched); err == nil {
+		t.Fatalf("expected the test of a different number to fail")
+	}
+
+	encoded := must(JsonCodec.Marshal(patch))
+	if !strings.Contains(string(encoded), `"value":9007199254740993`) {
+		t.Fatalf("expected the exact value when encoding, got %s", encoded)
+	}
+}
+
+type mergePatchInput = EndpointInput[X, recordsPath, X, MergePatch[patchUser]]
+type jsonPatchInput = EndpointInput[X, recordsPath, X, JSONPatch[patchUser]]
+type patchUserOutput = EndpointOutput[X, patchUser]
+
+var mergePatchEndpoint = Endpoint[mergePatchInput, patchUserOutput]{
+	Method: http.MethodPatch,
+	Handler: func(input mergePatchInput) (patchUserOutput, error) {
+		patched, err := input.Body.Apply(currentUser())
+		return BodyResponse(patched), err
+	},
+}
+
+var jsonPatchEndpoint = Endpoint[jsonPatchInput, patchUserOutput]{
+	Method: http.MethodPost,
+	Handler: func(input jsonPatchInput) (patchUserOutput, error) {
+		patched, err := input.Body.Apply(currentUser())
+		return BodyResponse(patched), err
+	},
+}
+
+func TestPatchEndpoints(t *testing.T) {
+	if diff := cmp.Diff([]string{MediaTypeMergePatch}, mergePatchEndpoint.GetConsumes()); diff != "" {
+		t.Fatalf("unexpected merge patch media types (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{MediaTypeJsonPatch}, jsonPatchEndpoint.GetConsumes()); diff != "" {
+		t.Fatalf("unexpected json patch media types (-want +got):\n%s", diff)
+	}
+	api := Api{Name: "patch"}.WithEndpoints(mergePatchEndpoint, jsonPatchEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	mergeClient := mergePatchEndpoint
+	mergeClient.Handler = nil
+	mergePatch, _ := NewMergePatch[patchUser](map[string]any{"name": "carol"})
+	output, err := mergeClient.RPC(server, NewInput(Empty, recordsPath{}, Empty, mergePatch), DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	if output.Body.Name != "carol" || output.Body.Address.City != "Bergen" {
+		t.Fatalf("unexpected patched user %+v", output.Body)
+	}
+
+	jsonClient := jsonPatchEndpoint
+	jsonClient.Handler = nil
+	jsonPatch, _ := NewJSONPatch[patchUser](JSONPatchOperation{Op: "test", Path: "/name", Value: Some(json.RawMessage(`"nobody"`))})
+	_, err = jsonClient.RPC(server, NewInput(Empty, recordsPath{}, Empty, jsonPatch), DefaultOpts())
+	var errResp ErrResp
+	if !errors.As(err, &errResp) || errResp.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a 422 error for a failed test, got %v", err)
+	}
+
+	for contentType, expectedStatus := range map[string]int{
+		MediaTypeMergePatch: http.StatusOK,
+		MediaTypeJson:       http.StatusUnsupportedMediaType,
+	} {
+		req, _ := http.NewRequest(http.MethodPatch, requestUrl(server, InputPayload{PathStr: "/records"}), strings.NewReader(`{"name":"dave"}`))
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("expected status %d for %s, got %d", expectedStatus, contentType, resp.StatusCode)
+		}
+	}
+}
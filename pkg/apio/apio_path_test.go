@@ -0,0 +1,105 @@
+package apio
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+)
+
+type filesPath struct {
+	_      any `path:"/buckets"`
+	Bucket string
+	_      any    `path:"/files"`
+	Rest   string `path:"*"`
+}
+
+type filesInput = EndpointInput[X, filesPath, X, X]
+type filesOutput = EndpointOutput[X, filesPath]
+
+var filesEndpoint = Endpoint[filesInput, filesOutput]{
+	Method: http.MethodGet,
+	Handler: func(input filesInput) (filesOutput, error) {
+		return BodyResponse(input.Path), nil
+	},
+}
+
+func TestCatchAllPath(t *testing.T) {
+	if filesEndpoint.GetPathPattern() != "/buckets/:Bucket/files/*" {
+		t.Fatalf("unexpected path pattern %s", filesEndpoint.GetPathPattern())
+	}
+	api := Api{Name: "files"}.WithEndpoints(filesEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	client := filesEndpoint
+	client.Handler = nil
+	for _, rest := range []string{"a/b/c.txt", "report 2024.pdf", "a%2Fb/ü?.txt", ""} {
+		input := NewInput(Empty, filesPath{Bucket: "docs", Rest: rest}, Empty, Empty)
+		output, err := client.RPC(server, input, DefaultOpts())
+		if err != nil {
+			t.Fatalf("failed to call endpoint with %q: %v", rest, err)
+		}
+		if diff := cmp.Diff(input.Path, output.Body); diff != "" {
+			t.Fatalf("unexpected path (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestCatchAllPathMustBeLast(t *testing.T) {
+	type badPath struct {
+		Rest string `path:"*"`
+		_    any    `path:"/files"`
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a catch-all field before other fields to panic")
+		}
+	}()
+	Endpoint[EndpointInput[X, badPath, X, X], EndpointOutput[X, X]]{Method: http.MethodGet}.GetPathPattern()
+}
+
+type userSettingPath struct {
+	_    any    `path:"/users"`
+	User int    `name:"userId" pattern:"[0-9]{1,6}"`
+	_    any    `path:"/settings"`
+	Cat  string `name:"settingCat" pattern:"[a-z]+"`
+}
+
+type userSettingInput = EndpointInput[X, userSettingPath, X, X]
+type userSettingOutput = EndpointOutput[X, userSettingPath]
+
+var userSettingEndpoint = Endpoint[userSettingInput, userSettingOutput]{
+	Method: http.MethodGet,
+	Handler: func(input userSettingInput) (userSettingOutput, error) {
+		return BodyResponse(input.Path), nil
+	},
+}
+
+func TestPathNamesAndPatterns(t *testing.T) {
+	if userSettingEndpoint.GetPathPattern() != "/users/:userId/settings/:settingCat" {
+		t.Fatalf("unexpected path pattern %s", userSettingEndpoint.GetPathPattern())
+	}
+	api := Api{Name: "users"}.WithEndpoints(userSettingEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	client := userSettingEndpoint
+	client.Handler = nil
+	input := NewInput(Empty, userSettingPath{User: 42, Cat: "theme"}, Empty, Empty)
+	output, err := client.RPC(server, input, DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to call endpoint: %v", err)
+	}
+	if diff := cmp.Diff(input.Path, output.Body); diff != "" {
+		t.Fatalf("unexpected path (-want +got):\n%s", diff)
+	}
+
+	for _, path := range []string{"/users/abc/settings/theme", "/users/1234567/settings/theme", "/users/42/settings/Theme"} {
+		resp, err := http.Get(requestUrl(server, InputPayload{PathStr: path}))
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status 404 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+}
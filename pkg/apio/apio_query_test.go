@@ -0,0 +1,77 @@
+package apio
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type statusFilter struct {
+	Status string `name:"status"`
+	Owner  *int   `name:"owner"`
+}
+
+type filterQuery struct {
+	Filter *statusFilter `name:"filter"`
+	Labels map[string]string
+	Limit  int
+}
+
+type filterInput = EndpointInput[X, recordsPath, filterQuery, X]
+type filterOutput = EndpointOutput[X, filterQuery]
+
+var filterEndpoint = Endpoint[filterInput, filterOutput]{
+	Method: http.MethodGet,
+	Handler: func(input filterInput) (filterOutput, error) {
+		return BodyResponse(input.Query), nil
+	},
+}
+
+func TestDeepObjectQuery(t *testing.T) {
+	if filterEndpoint.GetQueryPattern() != "?filter[..]=..&Labels[..]=..&Limit=.." {
+		t.Fatalf("unexpected query pattern %s", filterEndpoint.GetQueryPattern())
+	}
+	api := Api{Name: "filters"}.WithEndpoints(filterEndpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	client := filterEndpoint
+	client.Handler = nil
+	owner := 42
+	for _, query := range []filterQuery{
+		{Filter: &statusFilter{Status: "active", Owner: &owner}, Labels: map[string]string{"env": "prod", "team": "a&b"}, Limit: 10},
+		{Limit: 5},
+	} {
+		output, err := client.RPC(server, NewInput(Empty, recordsPath{}, query, Empty), DefaultOpts())
+		if err != nil {
+			t.Fatalf("failed to call endpoint: %v", err)
+		}
+		if diff := cmp.Diff(query, output.Body); diff != "" {
+			t.Fatalf("unexpected query (-want +got):\n%s", diff)
+		}
+	}
+
+	for query, expected := range map[string]string{
+		"?filter[status]=active&filter[owner]=42&Limit=1": `{"Filter":{"Status":"active","Owner":42},"Labels":null,"Limit":1}`,
+		"?filter[status]=active&Labels[env]=prod&Limit=1": `{"Filter":{"Status":"active","Owner":null},"Labels":{"env":"prod"},"Limit":1}`,
+		"?filter.status=active&filter.owner=7&Limit=1":    `{"Filter":{"Status":"active","Owner":7},"Labels":null,"Limit":1}`,
+		"?filter[owner]=7&Limit=1":                        "",
+		"?filter[status]=x&filter[owner]=seven&Limit=1":   "",
+	} {
+		resp, err := http.Get(requestUrl(server, InputPayload{PathStr: "/records"}) + query)
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if expected == "" {
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expected status 400 for %s, got %d", query, resp.StatusCode)
+			}
+			continue
+		}
+		if diff := cmp.Diff(expected, string(body)); diff != "" {
+			t.Fatalf("unexpected query for %s (-want +got):\n%s", query, diff)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package apio
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	SecurityTypeHttp   = "http"
+	SecurityTypeApiKey = "apiKey"
+)
+
+// SecurityScheme describes how a request is authenticated. Endpoints list the
+// schemes they accept in Endpoint.Security. The schemes are published in the
+// OpenAPI spec, extracted from requests on the server side and injected into
+// requests by RPC.
+type SecurityScheme struct {
+	Name         string // name of the scheme, e.g. in OpenAPI components.securitySchemes
+	Type         string // SecurityTypeHttp or SecurityTypeApiKey
+	Scheme       string // "bearer" or "basic", when Type is SecurityTypeHttp
+	BearerFormat string // e.g. "JWT", documentation only
+	In           string // "header", "query" or "cookie", when Type is SecurityTypeApiKey
+	ParamName    string // name of the header/query parameter/cookie, when Type is SecurityTypeApiKey
+	Description  string
+}
+
+// Credentials are what a client presents to authenticate using a SecurityScheme
+type Credentials struct {
+	Scheme   SecurityScheme
+	Token    string // bearer token or api key
+	Username string // basic auth
+	Password string // basic auth
+	// RequiredScopes are the scopes of the endpoint being called (set on the server side)
+	RequiredScopes []string
+}
+
+func BearerAuth(name string) SecurityScheme {
+	return SecurityScheme{Name: name, Type: SecurityTypeHttp, Scheme: "bearer"}
+}
+
+func BasicAuth(name string) SecurityScheme {
+	return SecurityScheme{Name: name, Type: SecurityTypeHttp, Scheme: "basic"}
+}
+
+func ApiKeyInHeader(name string, header string) SecurityScheme {
+	return SecurityScheme{Name: name, Type: SecurityTypeApiKey, In: "header", ParamName: header}
+}
+
+func ApiKeyInQuery(name string, param string) SecurityScheme {
+	return SecurityScheme{Name: name, Type: SecurityTypeApiKey, In: "query", ParamName: param}
+}
+
+func ApiKeyInCookie(name string, cookie string) SecurityScheme {
+	return SecurityScheme{Name: name, Type: SecurityTypeApiKey, In: "cookie", ParamName: cookie}
+}
+
+func BearerToken(token string) Credentials {
+	return Credentials{Token: token}
+}
+
+func ApiKey(key string) Credentials {
+	return Credentials{Token: key}
+}
+
+func UserPassword(username string, password string) Credentials {
+	return Credentials{Username: username, Password: password}
+}
+
+func (s SecurityScheme) validate() error {
+	if s.Name == "" {
+		return errors.New("security scheme must have a name")
+	}
+	switch s.Type {
+	case SecurityTypeHttp:
+		if s.Scheme != "bearer" && s.Scheme != "basic" {
+			return fmt.Errorf("unsupported http security scheme '%s' in %s", s.Scheme, s.Name)
+		}
+	case SecurityTypeApiKey:
+		if s.In != "header" && s.In != "query" && s.In != "cookie" {
+			return fmt.Errorf("unsupported api key location '%s' in %s", s.In, s.Name)
+		}
+		if s.ParamName == "" {
+			return fmt.Errorf("api key security scheme %s must have a ParamName", s.Name)
+		}
+	default:
+		return fmt.Errorf("unsupported security scheme type '%s' in %s", s.Type, s.Name)
+	}
+	return nil
+}
+
+// Extract finds the credentials of this scheme in a request payload
+func (s SecurityScheme) Extract(payload InputPayload) (Credentials, bool) {
+	switch s.Type {
+	case SecurityTypeHttp:
+		authorization := headerValue(payload.Headers, "Authorization")
+		prefix, value, found := strings.Cut(authorization, " ")
+		if !found || !strings.EqualFold(prefix, s.Scheme) {
+			return Credentials{}, false
+		}
+		value = strings.TrimSpace(value)
+		if s.Scheme == "basic" {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return Credentials{}, false
+			}
+			username, password, found := strings.Cut(string(decoded), ":")
+			if !found {
+				return Credentials{}, false
+			}
+			return Credentials{Scheme: s, Username: username, Password: password}, true
+		}
+		return Credentials{Scheme: s, Token: value}, value != ""
+	case SecurityTypeApiKey:
+		var value string
+		switch s.In {
+		case "header":
+			value = headerValue(payload.Headers, s.ParamName)
+		case "query":
+			if vs := payload.Query[s.ParamName]; len(vs) > 0 {
+				value = vs[0]
+			}
+		case "cookie":
+			req := http.Request{Header: http.Header{"Cookie": headerValues(payload.Headers, "Cookie")}}
+			if cookie, err := req.Cookie(s.ParamName); err == nil {
+				value = cookie.Value
+			}
+		}
+		return Credentials{Scheme: s, Token: value}, value != ""
+	}
+	return Credentials{}, false
+}
+
+// Inject adds the credentials to a request payload, as described by this scheme
+func (s SecurityScheme) Inject(payload *InputPayload, creds Credentials) {
+	if payload.Headers == nil {
+		payload.Headers = map[string][]string{}
+	}
+	switch s.Type {
+	case SecurityTypeHttp:
+		if s.Scheme == "basic" {
+			encoded := base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))
+			payload.Headers["Authorization"] = []string{"Basic " + encoded}
+		} else {
+			payload.Headers["Authorization"] = []string{"Bearer " + creds.Token}
+		}
+	case SecurityTypeApiKey:
+		switch s.In {
+		case "header":
+			payload.Headers[s.ParamName] = []string{creds.Token}
+		case "query":
+			if payload.Query == nil {
+				payload.Query = map[string][]string{}
+			}
+			payload.Query[s.ParamName] = []string{creds.Token}
+		case "cookie":
+			cookie := (&http.Cookie{Name: s.ParamName, Value: creds.Token}).String()
+			payload.Headers["Cookie"] = append(payload.Headers["Cookie"], cookie)
+		}
+	}
+}
+
+// extractCredentials returns the credentials of the first scheme present in the payload
+func extractCredentials(schemes []SecurityScheme, payload InputPayload) (Credentials, bool) {
+	for _, scheme := range schemes {
+		if creds, ok := scheme.Extract(payload); ok {
+			return creds, true
+		}
+	}
+	return Credentials{}, false
+}
+
+func headerValues(headers map[string][]string, name string) []string {
+	for k, vs := range headers {
+		if strings.EqualFold(k, name) {
+			return vs
+		}
+	}
+	return nil
+}
+
+func headerValue(headers map[string][]string, name string) string {
+	vs := headerValues(headers, name)
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+///// SECURE ENDPOINTS
+
+// SecureEndpoint is an Endpoint whose requests are authenticated before the
+// handler runs. The Authenticator turns the credentials of the request into
+// a typed principal, which is passed to the SecureHandler.
+type SecureEndpoint[Principal any, Input EndpointInputBase, Output EndpointOutputBase] struct {
+	Endpoint[Input, Output]
+	Authenticator func(Credentials) (Principal, error)
+	SecureHandler func(Principal, Input) (Output, error)
+}
+
+// securedEndpoint is implemented by endpoints enforcing their own security
+type securedEndpoint interface {
+	isSecured()
+}
+
+func (e SecureEndpoint[Principal, Input, Output]) isSecured() {}
+
+// Secured turns an endpoint into a SecureEndpoint, authenticating requests
+// using one of the endpoint's security schemes
+func Secured[Principal any, Input EndpointInputBase, Output EndpointOutputBase](
+	endpoint Endpoint[Input, Output],
+	authenticator func(Credentials) (Principal, error),
+) SecureEndpoint[Principal, Input, Output] {
+	return SecureEndpoint[Principal, Input, Output]{
+		Endpoint:      endpoint,
+		Authenticator: authenticator,
+	}
+}
+
+func (e SecureEndpoint[Principal, Input, Output]) WithHandler(handler func(Principal, Input) (Output, error)) SecureEndpoint[Principal, Input, Output] {
+	e.SecureHandler = handler
+	return e
+}
+
+func (e SecureEndpoint[Principal, Input, Output]) Handle(payload InputPayload) (EndpointOutputBase, error) {
+	var zeroOutput Output
+
+	principal, err := e.authenticate(payload)
+	if err != nil {
+		return zeroOutput, err
+	}
+	input, err := e.parseInput(payload)
+	if err != nil {
+		return zeroOutput, err
+	}
+	defer closeFiles(input.getBody())
+	output, err := e.SecureHandler(principal, input)
+	if err != nil {
+		return zeroOutput, handlerError(err)
+	}
+	return output, nil
+}
+
+func (e SecureEndpoint[Principal, Input, Output]) authenticate(payload InputPayload) (Principal, error) {
+	var zeroPrincipal Principal
+
+	creds, ok := extractCredentials(e.Security, payload)
+	if !ok {
+		return zeroPrincipal, NewError(http.StatusUnauthorized, "missing credentials", nil)
+	}
+	creds.RequiredScopes = e.Scopes
+	principal, err := e.Authenticator(creds)
+	if err != nil {
+		var errResp *ErrResp
+		if errors.As(err, &errResp) {
+			return zeroPrincipal, errResp
+		}
+		return zeroPrincipal, NewError(http.StatusUnauthorized, "invalid credentials", err)
+	}
+	return principal, nil
+}
+
+func (e SecureEndpoint[Principal, Input, Output]) RPC(
+	server Server,
+	input Input,
+	opts RPCOpts,
+) (Output, error) {
+
+	if e.SecureHandler != nil { // means we are testing locally, and have mocked the other side
+		var result Output
+		payload, err := e.requestPayload(input, opts)
+		if err != nil {
+			return result, err
+		}
+		output, err := e.Handle(payload)
+		if err != nil {
+			return result, err
+		}
+		return output.(Output), nil
+	}
+
+	return e.Endpoint.RPC(server, input, opts)
+}
+
+func (e SecureEndpoint[Principal, Input, Output]) validate(isServer bool) {
+	if len(e.Security) == 0 {
+		panic("no security schemes for secure endpoint " + e.GetId())
+	}
+	if isServer {
+		if e.Authenticator == nil {
+			panic("authenticator is nil for endpoint " + e.GetId())
+		}
+		if e.SecureHandler == nil {
+			panic("handler is nil for endpoint " + e.GetId())
+		}
+	}
+	e.Endpoint.validate(false)
+}
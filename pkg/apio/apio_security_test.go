@@ -0,0 +1,164 @@
+package apio
+
+import (
+	"bytes"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testPrincipal struct {
+	User string
+}
+
+type secretPath struct {
+	_ any `path:"/secrets"`
+}
+
+type secretBody struct {
+	Owner string
+}
+
+var bearerScheme = BearerAuth("bearer")
+var cookieScheme = ApiKeyInCookie("session", "session_id")
+
+func secretEndpoint() SecureEndpoint[testPrincipal, EndpointInput[X, secretPath, X, X], EndpointOutput[X, secretBody]] {
+	return Secured(
+		Endpoint[EndpointInput[X, secretPath, X, X], EndpointOutput[X, secretBody]]{
+			Method:   http.MethodGet,
+			Security: []SecurityScheme{bearerScheme, cookieScheme},
+		},
+		func(creds Credentials) (testPrincipal, error) {
+			if creds.Token != "good-token" {
+				return testPrincipal{}, errors.New("bad token")
+			}
+			return testPrincipal{User: "alice:" + creds.Scheme.Name}, nil
+		},
+	).WithHandler(func(principal testPrincipal, input EndpointInput[X, secretPath, X, X]) (EndpointOutput[X, secretBody], error) {
+		return BodyResponse(secretBody{Owner: principal.User}), nil
+	})
+}
+
+func TestSecureEndpointAuthenticates(t *testing.T) {
+	endpoint := secretEndpoint()
+	endpoint.validate(true)
+
+	result, err := endpoint.Handle(InputPayload{
+		Headers: map[string][]string{"Authorization": {"Bearer good-token"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to Handle call: %v", err)
+	}
+	if owner := result.(EndpointOutput[X, secretBody]).Body.Owner; owner != "alice:bearer" {
+		t.Fatalf("unexpected owner: %s", owner)
+	}
+
+	result, err = endpoint.Handle(InputPayload{
+		Headers: map[string][]string{"Cookie": {"other=1; session_id=good-token"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to Handle call: %v", err)
+	}
+	if owner := result.(EndpointOutput[X, secretBody]).Body.Owner; owner != "alice:session" {
+		t.Fatalf("unexpected owner: %s", owner)
+	}
+}
+
+func TestSecureEndpointRejects(t *testing.T) {
+	endpoint := secretEndpoint()
+
+	_, err := endpoint.Handle(InputPayload{})
+	if errResp := AsErResp(err); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for missing credentials, got %v", err)
+	}
+
+	_, err = endpoint.Handle(InputPayload{
+		Headers: map[string][]string{"Authorization": {"Bearer bad-token"}},
+	})
+	if errResp := AsErResp(err); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for bad credentials, got %v", err)
+	}
+}
+
+func TestBasicAuthRoundTrip(t *testing.T) {
+	scheme := BasicAuth("basic")
+	payload := InputPayload{}
+	scheme.Inject(&payload, UserPassword("bob", "s3cr:et"))
+	creds, ok := scheme.Extract(payload)
+	if !ok || creds.Username != "bob" || creds.Password != "s3cr:et" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+}
+
+func TestSecureEndpointRPC(t *testing.T) {
+
+	serverSide := secretEndpoint()
+	api := Api{Name: "secure"}.WithEndpoints(serverSide).Validate(true)
+	echoServer := echo.New()
+	EchoInstall(echoServer, &api)
+	httpServer := httptest.NewServer(echoServer)
+	defer httpServer.Close()
+
+	serverUrl, _ := url.Parse(httpServer.URL)
+	port, _ := strconv.Atoi(serverUrl.Port())
+	server := Server{Scheme: "http", Host: serverUrl.Hostname(), Port: port}
+
+	clientSide := serverSide.Endpoint
+	input := NewInput(Empty, secretPath{}, Empty, Empty)
+
+	_, err := clientSide.RPC(server, input, DefaultOpts())
+	var errResp ErrResp
+	if !errors.As(err, &errResp) || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %v", err)
+	}
+
+	res, err := clientSide.RPC(server, input, DefaultOpts().WithCredentials("session", ApiKey("good-token")))
+	if err != nil {
+		t.Fatalf("failed to call RPC: %v", err)
+	}
+	if res.Body.Owner != "alice:session" {
+		t.Fatalf("unexpected owner: %s", res.Body.Owner)
+	}
+
+	// mocked locally, still authenticating
+	res, err = serverSide.RPC(server, input, DefaultOpts().WithCredentials("bearer", BearerToken("good-token")))
+	if err != nil {
+		t.Fatalf("failed to call mocked RPC: %v", err)
+	}
+	if res.Body.Owner != "alice:bearer" {
+		t.Fatalf("unexpected owner: %s", res.Body.Owner)
+	}
+}
+
+func TestValidateWarnsAboutUnenforcedSecurity(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	unenforced := secretEndpoint().Endpoint.WithHandler(func(input EndpointInput[X, secretPath, X, X]) (EndpointOutput[X, secretBody], error) {
+		return BodyResponse(secretBody{}), nil
+	})
+	Api{Name: "secured"}.WithEndpoints(secretEndpoint()).Validate(true)
+	if logs.Len() != 0 {
+		t.Fatalf("expected no warning for a secure endpoint, got %s", logs.String())
+	}
+	Api{Name: "verified"}.WithEndpoints(unenforced).WithVerifiers(NewJWTVerifier(), testApiKeyVerifier{}).Validate(true)
+	if logs.Len() != 0 {
+		t.Fatalf("expected no warning with verifiers of all schemes, got %s", logs.String())
+	}
+	Api{Name: "partly"}.WithEndpoints(unenforced).WithVerifiers(NewJWTVerifier()).Validate(true)
+	if !strings.Contains(logs.String(), "rejects credentials of schemes [session]") {
+		t.Fatalf("expected a warning about the unverified cookie scheme, got %s", logs.String())
+	}
+	logs.Reset()
+	Api{Name: "middleware"}.WithEndpoints(unenforced).WithMiddlewares(NewJWTVerifier().Middleware()).Validate(true)
+	if !strings.Contains(logs.String(), "is not enforced") {
+		t.Fatalf("expected a warning about unenforced security with only a middleware, got %s", logs.String())
+	}
+}
@@ -0,0 +1,242 @@
+package apio
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Apio-Signature"
+	TimestampHeader = "X-Apio-Timestamp"
+	NonceHeader     = "X-Apio-Nonce"
+)
+
+// RequestSigner signs requests with a shared secret (HMAC-SHA256), for
+// service-to-service calls. Set it in RPCOpts.Signer to sign RPC calls.
+// The signature covers the method, path, sorted query, the selected
+// headers, a hash of the body, a timestamp and a nonce. Streamed bodies
+// are buffered, so that they can be hashed.
+type RequestSigner struct {
+	KeyId   string
+	Secret  []byte
+	Headers []string // headers to include in the signature
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+// RequestVerifier verifies requests signed by a RequestSigner. Use its
+// Middleware to reject unsigned, tampered, expired or replayed requests.
+type RequestVerifier struct {
+	Keys    map[string][]byte // secrets by key id
+	Headers []string          // headers included in the signature, must match the signer
+	MaxAge  time.Duration     // max clock difference of the timestamp, 5 minutes by default
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+
+	mutex      sync.Mutex
+	seenNonces map[string]time.Time
+}
+
+func NewRequestSigner(keyId string, secret []byte, headers ...string) *RequestSigner {
+	return &RequestSigner{
+		KeyId:   keyId,
+		Secret:  secret,
+		Headers: headers,
+	}
+}
+
+func NewRequestVerifier(keys map[string][]byte, headers ...string) *RequestVerifier {
+	return &RequestVerifier{
+		Keys:    keys,
+		Headers: headers,
+		MaxAge:  5 * time.Minute,
+	}
+}
+
+// Sign adds the timestamp, nonce and signature headers to the payload
+func (s *RequestSigner) Sign(method string, payload *InputPayload) error {
+	if err := bufferBody(payload); err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := hex.EncodeToString(nonceBytes)
+
+	if payload.Headers == nil {
+		payload.Headers = map[string][]string{}
+	}
+	payload.Headers[TimestampHeader] = []string{timestamp}
+	payload.Headers[NonceHeader] = []string{nonce}
+
+	signature := signRequest(s.Secret, canonicalRequest(method, *payload, s.Headers, timestamp, nonce))
+	payload.Headers[SignatureHeader] = []string{fmt.Sprintf("keyId=%s,signature=%s", s.KeyId, signature)}
+	return nil
+}
+
+// Verify checks the signature of a request. Failures are returned as 401 ErrResps.
+// Streamed bodies must be buffered first, as Middleware does.
+func (v *RequestVerifier) Verify(method string, payload InputPayload) error {
+	if payload.BodyReader != nil {
+		return NewError(http.StatusInternalServerError, "internal error", errors.New("can not verify the signature of a streamed body"))
+	}
+	signatureHeader := headerValue(payload.Headers, SignatureHeader)
+	timestamp := headerValue(payload.Headers, TimestampHeader)
+	nonce := headerValue(payload.Headers, NonceHeader)
+	if signatureHeader == "" || timestamp == "" || nonce == "" {
+		return signingUnauthorized("unsigned request")
+	}
+
+	keyId, signature := "", ""
+	for _, part := range strings.Split(signatureHeader, ",") {
+		k, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "keyId":
+			keyId = val
+		case "signature":
+			signature = val
+		}
+	}
+	secret, ok := v.Keys[keyId]
+	if !ok {
+		return signingUnauthorized("unknown key id '%s'", keyId)
+	}
+
+	expected := signRequest(secret, canonicalRequest(method, payload, v.Headers, timestamp, nonce))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return signingUnauthorized("bad signature")
+	}
+
+	unixSeconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return signingUnauthorized("bad timestamp")
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	maxAge := v.MaxAge
+	if maxAge == 0 {
+		maxAge = 5 * time.Minute
+	}
+	age := now.Sub(time.Unix(unixSeconds, 0))
+	if age > maxAge || age < -maxAge {
+		return signingUnauthorized("expired signature")
+	}
+
+	if !v.rememberNonce(keyId+":"+nonce, now, maxAge) {
+		return signingUnauthorized("replayed request")
+	}
+
+	return nil
+}
+
+// Middleware rejects requests that don't carry a valid signature. Streamed
+// bodies are buffered before verifying them.
+func (v *RequestVerifier) Middleware() Middleware {
+	return func(endpoint EndpointBase, payload InputPayload, next HandleFunc) (EndpointOutputBase, error) {
+		if err := bufferBody(&payload); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, bodyTooLarge(maxBytesErr.Limit)
+			}
+			return nil, NewError(http.StatusBadRequest, "failed to read body", err)
+		}
+		if err := v.Verify(endpoint.GetMethod(), payload); err != nil {
+			return nil, err
+		}
+		return next(payload)
+	}
+}
+
+// rememberNonce returns false if the nonce was already seen within maxAge
+func (v *RequestVerifier) rememberNonce(nonce string, now time.Time, maxAge time.Duration) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.seenNonces == nil {
+		v.seenNonces = map[string]time.Time{}
+	}
+	for n, seenAt := range v.seenNonces {
+		// a nonce can't be replayed once its timestamp is too old anyway
+		if now.Sub(seenAt) > 2*maxAge {
+			delete(v.seenNonces, n)
+		}
+	}
+	if _, seen := v.seenNonces[nonce]; seen {
+		return false
+	}
+	v.seenNonces[nonce] = now
+	return true
+}
+
+// bufferBody reads a streamed body into Body
+func bufferBody(payload *InputPayload) error {
+	if payload.BodyReader == nil {
+		return nil
+	}
+	body, err := io.ReadAll(payload.BodyReader)
+	if err != nil {
+		return err
+	}
+	payload.Body = body
+	payload.BodyReader = nil
+	return nil
+}
+
+func signingUnauthorized(format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	return NewError(http.StatusUnauthorized, "invalid request signature: "+msg, errors.New(msg))
+}
+
+func signRequest(secret []byte, canonical string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(canonical))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalRequest builds the string to sign:
+// method, path, sorted query, selected headers, body hash, timestamp and nonce, one per line
+func canonicalRequest(method string, payload InputPayload, headers []string, timestamp string, nonce string) string {
+	var result strings.Builder
+	result.WriteString(strings.ToUpper(method) + "\n")
+	result.WriteString(payload.PathStr + "\n")
+
+	queryParts := make([]string, 0, len(payload.Query))
+	for k, vs := range payload.Query {
+		for _, v := range vs {
+			queryParts = append(queryParts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(queryParts)
+	result.WriteString(strings.Join(queryParts, "&") + "\n")
+
+	for _, h := range headers {
+		values := headerValues(payload.Headers, h)
+		result.WriteString(strings.ToLower(h) + ":" + strings.Join(values, ",") + "\n")
+	}
+
+	bodyHash := sha256.Sum256(payload.Body)
+	result.WriteString(hex.EncodeToString(bodyHash[:]) + "\n")
+	result.WriteString(timestamp + "\n")
+	result.WriteString(nonce)
+	return result.String()
+}
@@ -0,0 +1,169 @@
+package apio
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signedPath struct {
+	_  any `path:"/transfers"`
+	Id string
+}
+
+type signedQuery struct {
+	Dry *bool
+}
+
+type signedBody struct {
+	Amount int
+}
+
+type signedEndpointT = Endpoint[
+	EndpointInput[X, signedPath, signedQuery, signedBody],
+	EndpointOutput[X, signedBody],
+]
+
+var signedEndpoint = signedEndpointT{
+	Method: http.MethodPost,
+}
+
+func TestSignedRPC(t *testing.T) {
+	verifier := NewRequestVerifier(map[string][]byte{"svc-a": []byte("shared-secret")})
+
+	serverSide := signedEndpoint.WithHandler(func(input EndpointInput[X, signedPath, signedQuery, signedBody]) (EndpointOutput[X, signedBody], error) {
+		return BodyResponse(input.Body), nil
+	})
+	api := Api{Name: "signed", IntBasePath: "/api"}.WithEndpoints(serverSide).WithMiddlewares(verifier.Middleware()).Validate(true)
+	server := startTestServer(t, &api)
+
+	dry := true
+	input := NewInput(Empty, signedPath{Id: "a/b c"}, signedQuery{Dry: &dry}, signedBody{Amount: 42})
+
+	opts := DefaultOpts()
+	opts.Signer = NewRequestSigner("svc-a", []byte("shared-secret"))
+	res, err := signedEndpoint.RPC(server, input, opts)
+	if err != nil {
+		t.Fatalf("failed to call signed RPC: %v", err)
+	}
+	if res.Body.Amount != 42 {
+		t.Fatalf("unexpected body: %+v", res.Body)
+	}
+
+	_, err = signedEndpoint.RPC(server, input, DefaultOpts())
+	var errResp ErrResp
+	if !errors.As(err, &errResp) || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unsigned request, got %v", err)
+	}
+
+	opts.Signer = NewRequestSigner("svc-a", []byte("wrong-secret"))
+	_, err = signedEndpoint.RPC(server, input, opts)
+	if !errors.As(err, &errResp) || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for bad signature, got %v", err)
+	}
+}
+
+func TestSignatureRejectsTamperedExpiredAndReplayed(t *testing.T) {
+	signer := NewRequestSigner("svc-a", []byte("shared-secret"), "Content-Type")
+	newVerifier := func() *RequestVerifier {
+		return NewRequestVerifier(map[string][]byte{"svc-a": []byte("shared-secret")}, "Content-Type")
+	}
+
+	signedPayload := func() InputPayload {
+		payload := InputPayload{
+			Headers: map[string][]string{"Content-Type": {"application/json"}},
+			PathStr: "/transfers/1",
+			Query:   map[string][]string{"b": {"2"}, "a": {"1", "0"}},
+			Body:    []byte(`{"Amount":42}`),
+		}
+		if err := signer.Sign(http.MethodPost, &payload); err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		return payload
+	}
+
+	if err := newVerifier().Verify(http.MethodPost, signedPayload()); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+
+	tampered := []func(p *InputPayload){
+		func(p *InputPayload) { p.Body = []byte(`{"Amount":43}`) },
+		func(p *InputPayload) { p.PathStr = "/transfers/2" },
+		func(p *InputPayload) { p.Query["a"] = []string{"1"} },
+		func(p *InputPayload) { p.Headers["Content-Type"] = []string{"text/plain"} },
+	}
+	for i, tamper := range tampered {
+		payload := signedPayload()
+		tamper(&payload)
+		if err := newVerifier().Verify(http.MethodPost, payload); err == nil {
+			t.Fatalf("tampering %d: expected error", i)
+		}
+	}
+
+	if err := newVerifier().Verify(http.MethodPut, signedPayload()); err == nil {
+		t.Fatalf("expected error for other method")
+	}
+
+	expiredVerifier := newVerifier()
+	expiredVerifier.Now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	if err := expiredVerifier.Verify(http.MethodPost, signedPayload()); err == nil {
+		t.Fatalf("expected error for expired signature")
+	}
+
+	replayVerifier := newVerifier()
+	payload := signedPayload()
+	if err := replayVerifier.Verify(http.MethodPost, payload); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if err := replayVerifier.Verify(http.MethodPost, payload); err == nil {
+		t.Fatalf("expected error for replayed request")
+	}
+}
+
+func TestSignatureCoversStreamedBody(t *testing.T) {
+	signer := NewRequestSigner("svc-a", []byte("shared-secret"))
+	verifier := NewRequestVerifier(map[string][]byte{"svc-a": []byte("shared-secret")})
+	handled := ""
+	handler := func(payload InputPayload) (EndpointOutputBase, error) {
+		handled = string(payload.Body)
+		return nil, nil
+	}
+
+	signedPayload := func() InputPayload {
+		payload := InputPayload{
+			PathStr:    "/uploads",
+			BodyReader: strings.NewReader("{\"Amount\":42}\n"),
+		}
+		if err := signer.Sign(http.MethodPost, &payload); err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		if payload.BodyReader != nil || string(payload.Body) != "{\"Amount\":42}\n" {
+			t.Fatalf("expected the streamed body to be buffered, got %q", payload.Body)
+		}
+		return payload
+	}
+
+	payload := signedPayload()
+	payload.BodyReader = strings.NewReader(string(payload.Body))
+	payload.Body = nil
+	if _, err := verifier.Middleware()(signedEndpoint, payload, handler); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if handled != "{\"Amount\":42}\n" {
+		t.Fatalf("expected the handler to get the buffered body, got %q", handled)
+	}
+
+	tampered := signedPayload()
+	tampered.BodyReader = strings.NewReader("{\"Amount\":43}\n")
+	tampered.Body = nil
+	_, err := verifier.Middleware()(signedEndpoint, tampered, handler)
+	if errResp := AsErResp(err); errResp == nil || errResp.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a tampered streamed body, got %v", err)
+	}
+
+	if err := verifier.Verify(http.MethodPost, InputPayload{BodyReader: strings.NewReader("")}); err == nil {
+		t.Fatalf("expected an error verifying an unbuffered streamed body")
+	}
+}
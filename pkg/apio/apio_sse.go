@@ -0,0 +1,350 @@
+package apio
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const MediaTypeEventStream = "text/event-stream"
+
+// DefaultHeartbeat is how often SSE endpoints send heartbeat comments, if not configured
+const DefaultHeartbeat = 15 * time.Second
+
+// EventStreamOutput is the output of SSE endpoints
+type EventStreamOutput = EndpointOutput[X, Stream]
+
+// Event is a Server-Sent Event with typed data, encoded as JSON
+type Event[T any] struct {
+	Id    string
+	Event string        // event type, "message" if empty
+	Retry time.Duration // reconnection time for the client, if not zero
+	Data  T
+}
+
+// EventStreamEndpoint is implemented by endpoints that respond with Server-Sent Events
+type EventStreamEndpoint interface {
+	GetEventType() reflect.Type
+}
+
+// SSEEndpoint is an endpoint that streams typed Server-Sent Events. The
+// EventHandler sends events until it returns, or until the client
+// disconnects, which cancels its context.
+type SSEEndpoint[Input EndpointInputBase, EventData any] struct {
+	Endpoint[Input, EventStreamOutput]
+	EventHandler func(ctx context.Context, input Input, events *EventSender[EventData]) error
+	// Heartbeat is how often comments are sent to keep the connection alive
+	// and detect disconnects. DefaultHeartbeat if 0, disabled if negative.
+	Heartbeat time.Duration
+}
+
+func (e SSEEndpoint[Input, EventData]) WithEventHandler(handler func(ctx context.Context, input Input, events *EventSender[EventData]) error) SSEEndpoint[Input, EventData] {
+	e.EventHandler = handler
+	return e
+}
+
+func (e SSEEndpoint[Input, EventData]) GetEventType() reflect.Type {
+	return reflect.TypeOf((*EventData)(nil)).Elem()
+}
+
+func (e SSEEndpoint[Input, EventData]) GetProduces() []string {
+	return []string{MediaTypeEventStream}
+}
+
+func (e SSEEndpoint[Input, EventData]) Handle(payload InputPayload) (EndpointOutputBase, error) {
+	input, err := e.parseInput(payload)
+	if err != nil {
+		return EventStreamOutput{}, err
+	}
+	return BodyResponse(e.start(input)), nil
+}
+
+// start runs the event handler, writing its events to the returned stream
+func (e SSEEndpoint[Input, EventData]) start(input Input) Stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	pipeReader, pipeWriter := io.Pipe()
+	sender := &EventSender[EventData]{ctx: ctx, writer: pipeWriter}
+
+	heartbeat := e.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	if heartbeat > 0 {
+		go func() {
+			ticker := time.NewTicker(heartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := sender.write(":\n\n"); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		err := e.EventHandler(ctx, input, sender)
+		if err != nil && ctx.Err() == nil {
+			slog.Error(fmt.Sprintf("event handler of endpoint %s failed: %v", e.GetId(), err))
+		}
+		cancel()
+		_ = pipeWriter.CloseWithError(err)
+	}()
+
+	return Stream{
+		ContentType: MediaTypeEventStream,
+		Length:      -1,
+		Flush:       true,
+		Reader:      &cancelOnClose{PipeReader: pipeReader, cancel: cancel},
+	}
+}
+
+// cancelOnClose cancels the event handler when the stream is closed, i.e. the client is gone
+type cancelOnClose struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	c.cancel()
+	return c.PipeReader.Close()
+}
+
+// Subscribe calls the endpoint and returns its stream of events. It is
+// not subject to the RPC timeout, cancel ctx or Close the stream to stop.
+func (e SSEEndpoint[Input, EventData]) Subscribe(
+	ctx context.Context,
+	server Server,
+	input Input,
+	opts RPCOpts,
+) (*EventStream[EventData], error) {
+
+	payload, err := e.requestPayload(input, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.EventHandler != nil { // means we are testing locally, and have mocked the other side
+		output, err := e.Handle(payload)
+		if err != nil {
+			return nil, err
+		}
+		stream, _ := output.GetStream()
+		events := newEventStream[EventData](stream.ReadCloser())
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = events.Close()
+			case <-events.done:
+			}
+		}()
+		return events, nil
+	}
+
+	req, err := newRequest(ctx, e.Method, server, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", MediaTypeEventStream)
+
+	client := http.Client{Jar: opts.Jar}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer func() { _ = resp.Body.Close() }()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, ErrResp{
+			Status: resp.StatusCode,
+			ClMsg:  fmt.Sprintf("non-2xx status code: %d, body: %s", resp.StatusCode, string(bodyBytes)),
+		}
+	}
+	return newEventStream[EventData](resp.Body), nil
+}
+
+func (e SSEEndpoint[Input, EventData]) validate(isServer bool) {
+	if isServer && e.EventHandler == nil {
+		panic("event handler is nil for endpoint " + e.GetId())
+	}
+	e.Endpoint.validate(false)
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+///// SENDING
+
+// EventSender writes typed events to the client. It is safe for concurrent use.
+type EventSender[T any] struct {
+	ctx    context.Context
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// Context is cancelled when the client disconnects
+func (s *EventSender[T]) Context() context.Context {
+	return s.ctx
+}
+
+// Send writes an event. It fails once the client has disconnected.
+func (s *EventSender[T]) Send(evt Event[T]) error {
+	data, err := json.Marshal(evt.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event data: %w", err)
+	}
+	var result strings.Builder
+	if evt.Id != "" {
+		result.WriteString("id: " + singleLine(evt.Id) + "\n")
+	}
+	if evt.Event != "" {
+		result.WriteString("event: " + singleLine(evt.Event) + "\n")
+	}
+	if evt.Retry > 0 {
+		result.WriteString("retry: " + strconv.FormatInt(evt.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		result.WriteString("data: " + line + "\n")
+	}
+	result.WriteString("\n")
+	return s.write(result.String())
+}
+
+// SendData writes an event with only data
+func (s *EventSender[T]) SendData(data T) error {
+	return s.Send(Event[T]{Data: data})
+}
+
+func (s *EventSender[T]) write(str string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.writer, str)
+	return err
+}
+
+func singleLine(str string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(str)
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+///// RECEIVING
+
+// EventStream reads typed events from an SSE response
+type EventStream[T any] struct {
+	reader      *bufio.Reader
+	closer      io.Closer
+	LastEventId string
+
+	closeOnce sync.Once
+	closeErr  error
+	done      chan struct{}
+}
+
+func newEventStream[T any](body io.ReadCloser) *EventStream[T] {
+	return &EventStream[T]{reader: bufio.NewReader(body), closer: body, done: make(chan struct{})}
+}
+
+// Next blocks until the next event, and returns io.EOF when the stream ends
+func (s *EventStream[T]) Next() (Event[T], error) {
+	var result Event[T]
+	var data []string
+	hasData := false
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil && (line == "" || err != io.EOF) {
+			return result, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			if !hasData {
+				result = Event[T]{} // comments, heartbeats or empty events
+				continue
+			}
+			result.Id = s.LastEventId
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &result.Data); err != nil {
+				return result, fmt.Errorf("failed to unmarshal event data: %w", err)
+			}
+			return result, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			s.LastEventId = value
+		case "event":
+			result.Event = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				result.Retry = time.Duration(ms) * time.Millisecond
+			}
+		case "data":
+			data = append(data, value)
+			hasData = true
+		}
+	}
+}
+
+// Channel delivers the events on a channel, which is closed when the stream
+// ends or is closed. The error that ended it, if other than io.EOF, is sent to
+// errs if not nil and ready to receive it, e.g. buffered. Consumers that stop
+// reading must Close the stream.
+func (s *EventStream[T]) Channel(errs chan<- error) <-chan Event[T] {
+	result := make(chan Event[T])
+	go func() {
+		defer close(result)
+		for {
+			evt, err := s.Next()
+			if err != nil {
+				if err != io.EOF && errs != nil && !s.isClosed() {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+				return
+			}
+			select {
+			case result <- evt:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return result
+}
+
+func (s *EventStream[T]) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *EventStream[T]) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.closeErr = s.closer.Close()
+	})
+	return s.closeErr
+}
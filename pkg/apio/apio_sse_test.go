@@ -0,0 +1,221 @@
+package apio
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+type ticksPath struct {
+	_ any `path:"/ticks"`
+}
+
+type ticksQuery struct {
+	Count int
+}
+
+type tick struct {
+	N    int
+	Note string
+}
+
+type ticksEndpointT = SSEEndpoint[EndpointInput[X, ticksPath, ticksQuery, X], tick]
+
+var ticksEndpoint = ticksEndpointT{
+	Endpoint: Endpoint[EndpointInput[X, ticksPath, ticksQuery, X], EventStreamOutput]{
+		Method: http.MethodGet,
+	},
+}
+
+func sendTicks(ctx context.Context, input EndpointInput[X, ticksPath, ticksQuery, X], events *EventSender[tick]) error {
+	for i := 1; i <= input.Query.Count; i++ {
+		err := events.Send(Event[tick]{
+			Id:    strconv.Itoa(i),
+			Event: "tick",
+			Retry: time.Second,
+			Data:  tick{N: i, Note: "line 1\nline 2"},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readAllEvents(t *testing.T, stream *EventStream[tick]) []Event[tick] {
+	defer func() { _ = stream.Close() }()
+	result := make([]Event[tick], 0)
+	for {
+		evt, err := stream.Next()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		result = append(result, evt)
+	}
+}
+
+func TestSSESubscribe(t *testing.T) {
+	api := Api{Name: "sse"}.WithEndpoints(ticksEndpoint.WithEventHandler(sendTicks)).Validate(true)
+	server := startTestServer(t, &api)
+
+	input := NewInput(Empty, ticksPath{}, ticksQuery{Count: 3}, Empty)
+	stream, err := ticksEndpoint.Subscribe(context.Background(), server, input, DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	events := readAllEvents(t, stream)
+
+	expected := make([]Event[tick], 0)
+	for i := 1; i <= 3; i++ {
+		expected = append(expected, Event[tick]{Id: strconv.Itoa(i), Event: "tick", Retry: time.Second, Data: tick{N: i, Note: "line 1\nline 2"}})
+	}
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Fatalf("events mismatch:\n%s", diff)
+	}
+	if stream.LastEventId != "3" {
+		t.Fatalf("unexpected last event id: %s", stream.LastEventId)
+	}
+
+	// locally, with the handler mocked
+	stream = must(ticksEndpoint.WithEventHandler(sendTicks).Subscribe(context.Background(), Server{}, input, DefaultOpts()))
+	if diff := cmp.Diff(expected, readAllEvents(t, stream)); diff != "" {
+		t.Fatalf("local events mismatch:\n%s", diff)
+	}
+}
+
+func TestSSEDisconnectCancelsHandler(t *testing.T) {
+	cancelled := make(chan struct{})
+	endpoint := ticksEndpoint.WithEventHandler(func(ctx context.Context, input EndpointInput[X, ticksPath, ticksQuery, X], events *EventSender[tick]) error {
+		defer close(cancelled)
+		for i := 0; ; i++ {
+			if err := events.SendData(tick{N: i}); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	})
+	api := Api{Name: "sse"}.WithEndpoints(endpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	stream := must(ticksEndpoint.Subscribe(context.Background(), server, NewInput(Empty, ticksPath{}, ticksQuery{}, Empty), DefaultOpts()))
+	errs := make(chan error, 1)
+	received := 0
+	for evt := range stream.Channel(errs) {
+		if evt.Data.N != received {
+			t.Fatalf("unexpected event: %+v", evt)
+		}
+		received++
+		if received == 2 {
+			_ = stream.Close()
+		}
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("handler was not cancelled after the client disconnected")
+	}
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	endpoint := ticksEndpoint.WithEventHandler(func(ctx context.Context, input EndpointInput[X, ticksPath, ticksQuery, X], events *EventSender[tick]) error {
+		<-ctx.Done()
+		return nil
+	})
+	endpoint.Heartbeat = 5 * time.Millisecond
+
+	output := must(endpoint.Handle(InputPayload{Headers: map[string][]string{}, Query: map[string][]string{"Count": {"0"}}}))
+	stream, isStream := output.GetStream()
+	if !isStream || stream.ContentType != MediaTypeEventStream || !stream.Flush {
+		t.Fatalf("expected a flushed event stream, got %+v", stream)
+	}
+	defer func() { _ = stream.ReadCloser().Close() }()
+
+	line, err := bufio.NewReader(stream.Reader).ReadString('\n')
+	if err != nil || line != ":\n" {
+		t.Fatalf("expected heartbeat comment, got '%s', %v", line, err)
+	}
+}
+
+func expectClosedChannel(t *testing.T, events <-chan Event[tick]) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("event channel was not closed")
+		}
+	}
+}
+
+func TestEventStreamChannelStopsWhenClosed(t *testing.T) {
+	reader, writer := io.Pipe()
+	go func() {
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(writer, "data: {\"N\":%d}\n\n", i); err != nil {
+				return
+			}
+		}
+	}()
+	stream := newEventStream[tick](reader)
+	events := stream.Channel(make(chan error)) // nobody receives the errors
+
+	if evt := <-events; evt.Data.N != 0 {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+	_ = stream.Close()
+	expectClosedChannel(t, events)
+}
+
+func TestEventStreamChannelDoesNotBlockOnErrors(t *testing.T) {
+	failing := io.MultiReader(strings.NewReader("data: {\"N\":1}\n\n"), iotest.ErrReader(errors.New("connection reset")))
+	stream := newEventStream[tick](io.NopCloser(failing))
+	unread := make(chan error)
+	events := stream.Channel(unread)
+	expectClosedChannel(t, events)
+
+	buffered := make(chan error, 1)
+	stream = newEventStream[tick](io.NopCloser(iotest.ErrReader(errors.New("connection reset"))))
+	expectClosedChannel(t, stream.Channel(buffered))
+	if err := <-buffered; err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected the error that ended the stream, got %v", err)
+	}
+}
+
+func TestLocalSubscribeDoesNotLeak(t *testing.T) {
+	endpoint := ticksEndpoint.WithEventHandler(sendTicks)
+	input := NewInput(Empty, ticksPath{}, ticksQuery{Count: 1}, Empty)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		stream := must(endpoint.Subscribe(context.Background(), Server{}, input, DefaultOpts()))
+		readAllEvents(t, stream)
+		_ = stream.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before+2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked goroutines: %d before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
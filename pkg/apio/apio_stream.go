@@ -0,0 +1,181 @@
+package apio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const MediaTypeOctetStream = "application/octet-stream"
+
+// Stream is a response body streamed from a reader, e.g. a file download.
+// Server adapters stream it without buffering, and serve Range requests
+// if the Reader is an io.ReadSeeker. RPC callers get the response body as
+// Reader, which they must close. Note that the RPC timeout includes reading it.
+type Stream struct {
+	ContentType string
+	Length      int64 // unknown if -1, or 0 with a Reader
+	// Filename sets a Content-Disposition attachment header, if not empty
+	Filename string
+	// ModTime is used for conditional and Range requests, if not zero
+	ModTime time.Time
+	// ContentRange is the Content-Range of partial responses (client side)
+	ContentRange string
+	// Flush sends every write to the client right away, e.g. for event streams
+	Flush  bool
+	Reader io.Reader
+}
+
+var streamType = reflect.TypeOf(Stream{})
+
+func NewStream(contentType string, length int64, reader io.Reader) Stream {
+	return Stream{ContentType: contentType, Length: length, Reader: reader}
+}
+
+// Attachment returns a copy of the stream, downloaded as the named file
+func (s Stream) Attachment(filename string) Stream {
+	s.Filename = filename
+	return s
+}
+
+// ReadCloser returns the reader as an io.ReadCloser
+func (s Stream) ReadCloser() io.ReadCloser {
+	if rc, ok := s.Reader.(io.ReadCloser); ok {
+		return rc
+	}
+	return io.NopCloser(s.Reader)
+}
+
+func (s Stream) contentType() string {
+	if s.ContentType == "" {
+		return MediaTypeOctetStream
+	}
+	return s.ContentType
+}
+
+// Headers returns the response headers describing the stream
+func (s Stream) Headers() map[string][]string {
+	result := map[string][]string{
+		"Content-Type": {s.contentType()},
+	}
+	if s.Filename != "" {
+		result["Content-Disposition"] = []string{mime.FormatMediaType("attachment", map[string]string{"filename": s.Filename})}
+	}
+	return result
+}
+
+// ServeHTTP writes the stream, using http.ServeContent for seekable readers
+// to support Range and conditional requests. The reader is closed when done,
+// or as soon as the client disconnects. A nil Reader is an empty body.
+func (s Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Reader == nil {
+		s.Reader = bytes.NewReader(nil)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+		_ = s.ReadCloser().Close()
+	}()
+
+	for k, vs := range s.Headers() {
+		w.Header()[k] = vs
+	}
+	if seeker, ok := s.Reader.(io.ReadSeeker); ok && !s.Flush {
+		http.ServeContent(w, r, s.Filename, s.ModTime, seeker)
+		return
+	}
+	if s.Length > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(s.Length, 10))
+	}
+	if s.Flush && w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if flusher, ok := w.(http.Flusher); ok && s.Flush {
+		flusher.Flush()
+		_, _ = io.Copy(flushWriter{w: w, flusher: flusher}, s.Reader)
+	} else {
+		_, _ = io.Copy(w, s.Reader)
+	}
+}
+
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.flusher.Flush()
+	return n, err
+}
+
+// streamOfResponse wraps a response body as a Stream
+func streamOfResponse(resp *http.Response) Stream {
+	stream := Stream{
+		ContentType:  resp.Header.Get("Content-Type"),
+		Length:       resp.ContentLength,
+		ContentRange: resp.Header.Get("Content-Range"),
+		Reader:       resp.Body,
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		stream.Filename = params["filename"]
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		stream.ModTime = modTime
+	}
+	return stream
+}
+
+func (e EndpointOutput[HeadersType, BodyType]) GetStream() (Stream, bool) {
+	stream, ok := any(e.Body).(Stream)
+	return stream, ok
+}
+
+func (e EndpointOutput[HeadersType, BodyType]) GetHandler() (http.Handler, bool) {
+	handler, ok := any(e.Body).(http.Handler)
+	return handler, ok
+}
+
+func (e EndpointOutput[HeadersType, BodyType]) isStreamed() bool {
+	_, isStream := e.GetStream()
+	return isStream || isItemsType(reflect.TypeOf(e.Body))
+}
+
+func (e EndpointOutput[HeadersType, BodyType]) withStream(stream Stream) EndpointOutputBase {
+	if body, ok := any(stream).(BodyType); ok {
+		e.Body = body
+	} else if target, ok := any(&e.Body).(itemsTarget); ok {
+		target.setReader(stream.ReadCloser(), stream.ContentType)
+	}
+	return e
+}
+
+// readStream buffers a stream body, for adapters and callers that need bytes
+func readStream(stream Stream) ([]byte, error) {
+	if stream.Reader == nil {
+		return []byte{}, nil
+	}
+	defer func() { _ = stream.ReadCloser().Close() }()
+	result, err := io.ReadAll(stream.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return result, nil
+}
+
+func bytesStream(contentType string, body []byte) Stream {
+	return NewStream(contentType, int64(len(body)), bytes.NewReader(body))
+}
@@ -0,0 +1,110 @@
+package apio
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type downloadPath struct {
+	_    any `path:"/files"`
+	Name string
+}
+
+type downloadHeaders struct {
+	Range *string
+}
+
+type downloadEndpointT = Endpoint[
+	EndpointInput[downloadHeaders, downloadPath, X, X],
+	EndpointOutput[X, Stream],
+]
+
+const downloadContent = "0123456789abcdefghij"
+
+func TestStreamDownload(t *testing.T) {
+	endpoint := downloadEndpointT{
+		Method: http.MethodGet,
+	}
+	serverSide := endpoint.WithHandler(func(input EndpointInput[downloadHeaders, downloadPath, X, X]) (EndpointOutput[X, Stream], error) {
+		if input.Path.Name == "piped" {
+			// not seekable, so streamed as is
+			reader := io.MultiReader(strings.NewReader(downloadContent))
+			return BodyResponse(NewStream("text/plain", int64(len(downloadContent)), reader)), nil
+		}
+		stream := NewStream("text/plain", int64(len(downloadContent)), strings.NewReader(downloadContent)).Attachment(input.Path.Name)
+		stream.ModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		return BodyResponse(stream), nil
+	})
+	api := Api{Name: "downloads"}.WithEndpoints(serverSide).Validate(true)
+	server := startTestServer(t, &api)
+
+	read := func(stream Stream) string {
+		defer func() { _ = stream.ReadCloser().Close() }()
+		return string(must(io.ReadAll(stream.Reader)))
+	}
+
+	res := must(endpoint.RPC(server, NewInput(downloadHeaders{}, downloadPath{Name: "report.txt"}, Empty, Empty), DefaultOpts()))
+	if content := read(res.Body); content != downloadContent {
+		t.Fatalf("unexpected content: %s", content)
+	}
+	if res.Body.Filename != "report.txt" || res.Body.Length != int64(len(downloadContent)) || !strings.HasPrefix(res.Body.ContentType, "text/plain") {
+		t.Fatalf("unexpected stream info: %+v", res.Body)
+	}
+	if !res.Body.ModTime.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("unexpected mod time: %v", res.Body.ModTime)
+	}
+
+	byteRange := "bytes=5-9"
+	res = must(endpoint.RPC(server, NewInput(downloadHeaders{Range: &byteRange}, downloadPath{Name: "report.txt"}, Empty, Empty), DefaultOpts()))
+	if content := read(res.Body); content != "56789" {
+		t.Fatalf("unexpected range content: %s", content)
+	}
+	if res.Body.ContentRange != "bytes 5-9/20" {
+		t.Fatalf("unexpected content range: %s", res.Body.ContentRange)
+	}
+
+	res = must(endpoint.RPC(server, NewInput(downloadHeaders{Range: &byteRange}, downloadPath{Name: "piped"}, Empty, Empty), DefaultOpts()))
+	if content := read(res.Body); content != downloadContent {
+		t.Fatalf("unexpected piped content: %s", content)
+	}
+	if res.Body.ContentRange != "" || res.Body.Filename != "" {
+		t.Fatalf("unexpected piped stream info: %+v", res.Body)
+	}
+}
+
+func TestStreamAsBytes(t *testing.T) {
+	output := BodyResponse(NewStream("text/plain", -1, strings.NewReader("hello")))
+	body, err := output.GetBody()
+	if err != nil || string(body) != "hello" {
+		t.Fatalf("unexpected stream body: %s, %v", body, err)
+	}
+	if output.OkCode() != http.StatusOK {
+		t.Fatalf("unexpected ok code: %d", output.OkCode())
+	}
+}
+
+func TestServeStreamWithoutReader(t *testing.T) {
+	for _, stream := range []Stream{{}, NewStream("text/plain", -1, nil)} {
+		recorder := httptest.NewRecorder()
+		stream.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 {
+			t.Fatalf("expected an empty 200 response, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestServeStreamLiteralWithoutLength(t *testing.T) {
+	stream := Stream{ContentType: "text/plain", Reader: io.MultiReader(strings.NewReader("hello"))}
+	recorder := httptest.NewRecorder()
+	stream.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if length := recorder.Header().Get("Content-Length"); length != "" {
+		t.Fatalf("expected no Content-Length for an unknown length, got %s", length)
+	}
+	if recorder.Body.String() != "hello" {
+		t.Fatalf("unexpected body: %s", recorder.Body.String())
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/google/go-cmp/cmp"
+	"github.com/labstack/echo/v4"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"testing"
 )
 
@@ -196,6 +200,18 @@ func TestGetUserMissingPath(t *testing.T) {
 	}
 }
 
+// startTestServer serves the api on a local echo server, until the test ends
+func startTestServer(t *testing.T, api *Api) Server {
+	echoServer := echo.New()
+	EchoInstall(echoServer, api)
+	httpServer := httptest.NewServer(echoServer)
+	t.Cleanup(httpServer.Close)
+
+	serverUrl, _ := url.Parse(httpServer.URL)
+	port, _ := strconv.Atoi(serverUrl.Port())
+	return Server{Scheme: "http", Host: serverUrl.Hostname(), Port: port, BasePath: api.IntBasePath}
+}
+
 func must[T any](t T, err error) T {
 	if err != nil {
 		panic(err)
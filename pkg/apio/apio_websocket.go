@@ -0,0 +1,406 @@
+package apio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPingInterval is how often WebSocket endpoints ping the other side, if not configured
+const DefaultPingInterval = 30 * time.Second
+
+// DefaultWriteTimeout is how long WebSocket writes may block, if not configured
+const DefaultWriteTimeout = 10 * time.Second
+
+// DefaultReceiveBuffer is how many inbound WebSocket messages are read ahead, if not configured
+const DefaultReceiveBuffer = 16
+
+// Close codes of WebSocket connections, see RFC 6455
+const (
+	CloseNormalClosure     = websocket.CloseNormalClosure
+	CloseGoingAway         = websocket.CloseGoingAway
+	CloseUnsupportedData   = websocket.CloseUnsupportedData
+	ClosePolicyViolation   = websocket.ClosePolicyViolation
+	CloseMessageTooBig     = websocket.CloseMessageTooBig
+	CloseInternalServerErr = websocket.CloseInternalServerErr
+)
+
+// CloseError is a WebSocket close frame. Socket handlers can return one
+// to close the connection with a specific code.
+type CloseError = websocket.CloseError
+
+// WebSocketOutput is the output of WebSocket endpoints
+type WebSocketOutput = EndpointOutput[X, WebSocketUpgrade]
+
+// WebSocketUpgrade is a response body that upgrades the connection to a
+// WebSocket, and runs the socket handler on it
+type WebSocketUpgrade struct {
+	serve func(w http.ResponseWriter, r *http.Request)
+}
+
+func (u WebSocketUpgrade) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if u.serve == nil {
+		http.Error(w, "no websocket handler", http.StatusInternalServerError)
+		return
+	}
+	u.serve(w, r)
+}
+
+// WebSocketEndpoint is implemented by endpoints that upgrade to WebSockets
+type WebSocketEndpoint interface {
+	// GetMessageTypes returns the types of messages sent by the client and the server
+	GetMessageTypes() (inbound reflect.Type, outbound reflect.Type)
+}
+
+// WSEndpoint is a WebSocket endpoint, exchanging typed messages. Inbound
+// messages (In) are decoded with the first Consumes codec, outbound
+// messages (Out) encoded with the first Produces codec. Text based media
+// types are sent as text frames, others as binary frames. MaxBodyBytes
+// limits the size of inbound messages.
+type WSEndpoint[Input EndpointInputBase, In any, Out any] struct {
+	Endpoint[Input, WebSocketOutput]
+	SocketHandler func(ctx context.Context, input Input, conn *WSConn[In, Out]) error
+	// PingInterval is how often pings are sent, connections that don't answer
+	// in time are closed. DefaultPingInterval if 0, disabled if negative.
+	PingInterval time.Duration
+	// WriteTimeout is how long a write may block, DefaultWriteTimeout if 0
+	WriteTimeout time.Duration
+	// ReceiveBuffer is how many messages are read ahead, DefaultReceiveBuffer if 0
+	ReceiveBuffer int
+	// CheckOrigin allows cross-origin requests it returns true for.
+	// If nil, only requests without Origin or from the same host are accepted.
+	CheckOrigin func(r *http.Request) bool
+}
+
+func (e WSEndpoint[Input, In, Out]) WithSocketHandler(handler func(ctx context.Context, input Input, conn *WSConn[In, Out]) error) WSEndpoint[Input, In, Out] {
+	e.SocketHandler = handler
+	return e
+}
+
+func (e WSEndpoint[Input, In, Out]) GetMessageTypes() (reflect.Type, reflect.Type) {
+	return reflect.TypeOf((*In)(nil)).Elem(), reflect.TypeOf((*Out)(nil)).Elem()
+}
+
+func (e WSEndpoint[Input, In, Out]) OkCode() int {
+	return http.StatusSwitchingProtocols
+}
+
+func (e WSEndpoint[Input, In, Out]) Handle(payload InputPayload) (EndpointOutputBase, error) {
+	input, err := e.parseInput(payload)
+	if err != nil {
+		return WebSocketOutput{}, err
+	}
+	return BodyResponse(e.upgrade(input)), nil
+}
+
+// upgrade returns the body that upgrades the connection and runs the socket handler.
+// The handler's context is cancelled when the connection is closed.
+func (e WSEndpoint[Input, In, Out]) upgrade(input Input) WebSocketUpgrade {
+	return WebSocketUpgrade{serve: func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{CheckOrigin: e.CheckOrigin}
+		conn, err := upgrader.Upgrade(w, r, w.Header().Clone())
+		if err != nil { // the upgrader has already responded
+			slog.Warn(fmt.Sprintf("websocket upgrade of endpoint %s failed: %v", e.GetId(), err))
+			return
+		}
+		socket := newWSConn[In, Out](conn, mustGetCodec(e.GetConsumes()[0]), mustGetCodec(e.GetProduces()[0]), e.settings())
+		err = e.SocketHandler(socket.Context(), input, socket)
+		code, text := closeOfError(err)
+		if code == CloseInternalServerErr {
+			slog.Error(fmt.Sprintf("socket handler of endpoint %s failed: %v", e.GetId(), err))
+		}
+		_ = socket.Close(code, text)
+	}}
+}
+
+// closeOfError returns the close frame for the result of a socket handler
+func closeOfError(err error) (int, string) {
+	var closeErr *CloseError
+	switch {
+	case err == nil || errors.Is(err, io.EOF):
+		return CloseNormalClosure, ""
+	case errors.As(err, &closeErr):
+		return closeErr.Code, closeErr.Text
+	default:
+		return CloseInternalServerErr, "internal error"
+	}
+}
+
+// Dial connects to the endpoint. The connection outlives ctx, which only
+// bounds the handshake, together with the opts Timeout. Unlike RPC, Dial
+// always connects to the server, also when a SocketHandler is set.
+func (e WSEndpoint[Input, In, Out]) Dial(
+	ctx context.Context,
+	server Server,
+	input Input,
+	opts RPCOpts,
+) (*WSConn[Out, In], error) {
+
+	payload, err := e.requestPayload(input, opts)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	for k, vs := range payload.Headers {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: opts.Timeout,
+		Jar:              opts.Jar,
+	}
+	url := "ws" + strings.TrimPrefix(requestUrl(server, payload), "http")
+	conn, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			return nil, ErrResp{
+				Status: resp.StatusCode,
+				ClMsg:  fmt.Sprintf("websocket handshake failed with status code: %d, body: %s", resp.StatusCode, string(bodyBytes)),
+			}
+		}
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	return newWSConn[Out, In](conn, mustGetCodec(e.GetProduces()[0]), mustGetCodec(e.GetConsumes()[0]), e.settings()), nil
+}
+
+func (e WSEndpoint[Input, In, Out]) settings() wsSettings {
+	result := wsSettings{
+		pingInterval:  e.PingInterval,
+		writeTimeout:  e.WriteTimeout,
+		receiveBuffer: e.ReceiveBuffer,
+		readLimit:     e.MaxBodyBytes,
+	}
+	if result.pingInterval == 0 {
+		result.pingInterval = DefaultPingInterval
+	}
+	if result.writeTimeout <= 0 {
+		result.writeTimeout = DefaultWriteTimeout
+	}
+	if result.receiveBuffer <= 0 {
+		result.receiveBuffer = DefaultReceiveBuffer
+	}
+	return result
+}
+
+func (e WSEndpoint[Input, In, Out]) validate(isServer bool) {
+	if isServer && e.SocketHandler == nil {
+		panic("socket handler is nil for endpoint " + e.GetId())
+	}
+	e.Endpoint.validate(false)
+	if e.Method != http.MethodGet {
+		panic("websocket endpoint " + e.GetId() + " must use method GET")
+	}
+	inputBodyInfo := e.GetBodyInputInfo()
+	if inputBodyInfo.HasContent() {
+		panic("websocket endpoint " + e.GetId() + " can't have a request body")
+	}
+	for _, mediaType := range []string{e.GetConsumes()[0], e.GetProduces()[0]} {
+		if mustGetCodec(mediaType).IsStreaming() {
+			panic(fmt.Sprintf("websocket endpoint %s can't use streaming codec '%s' for messages", e.GetId(), mediaType))
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////
+///// CONNECTION
+
+type wsSettings struct {
+	pingInterval  time.Duration
+	writeTimeout  time.Duration
+	receiveBuffer int
+	readLimit     int64
+}
+
+type wsReceived[T any] struct {
+	msg T
+	err error
+}
+
+// WSConn is a WebSocket connection receiving Recv and sending Send messages.
+// Inbound messages are read ahead into a bounded buffer; when it is full,
+// reading stops until Receive is called, which slows down the other side.
+// Pings and pongs are handled in the background.
+type WSConn[Recv any, Send any] struct {
+	conn        *websocket.Conn
+	ctx         context.Context
+	cancel      context.CancelFunc
+	recvCodec   Codec
+	sendCodec   Codec
+	messageType int
+	settings    wsSettings
+	writeMutex  sync.Mutex
+	received    chan wsReceived[Recv]
+	readErr     error
+	closing     chan struct{}
+	closeOnce   sync.Once
+}
+
+func newWSConn[Recv any, Send any](conn *websocket.Conn, recvCodec Codec, sendCodec Codec, settings wsSettings) *WSConn[Recv, Send] {
+	ctx, cancel := context.WithCancel(context.Background())
+	result := &WSConn[Recv, Send]{
+		conn:        conn,
+		ctx:         ctx,
+		cancel:      cancel,
+		recvCodec:   recvCodec,
+		sendCodec:   sendCodec,
+		messageType: websocket.BinaryMessage,
+		settings:    settings,
+		received:    make(chan wsReceived[Recv], settings.receiveBuffer),
+		closing:     make(chan struct{}),
+	}
+	if isTextMediaType(sendCodec.MediaType) {
+		result.messageType = websocket.TextMessage
+	}
+	if settings.readLimit > 0 {
+		conn.SetReadLimit(settings.readLimit)
+	}
+	if settings.pingInterval > 0 {
+		result.extendReadDeadline()
+		conn.SetPongHandler(func(string) error {
+			result.extendReadDeadline()
+			return nil
+		})
+		go result.pingLoop()
+	}
+	go result.readLoop()
+	return result
+}
+
+// Context is cancelled when the connection is closed
+func (c *WSConn[Recv, Send]) Context() context.Context {
+	return c.ctx
+}
+
+// Receive blocks until the next message, and returns io.EOF when the
+// connection was closed normally, or a *CloseError with another code.
+// Messages that can't be decoded give a *CloseError with code
+// CloseUnsupportedData, without closing the connection.
+func (c *WSConn[Recv, Send]) Receive() (Recv, error) {
+	item, ok := <-c.received
+	if !ok {
+		var zero Recv
+		return zero, c.readErr
+	}
+	return item.msg, item.err
+}
+
+// Send blocks until the message is written, so that slow receivers slow
+// down the sender instead of messages piling up. It fails if the write
+// takes longer than the write timeout.
+func (c *WSConn[Recv, Send]) Send(msg Send) error {
+	data, err := c.sendCodec.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.settings.writeTimeout))
+	return c.conn.WriteMessage(c.messageType, data)
+}
+
+// Close sends a close frame, waits for the other side to respond, and
+// closes the connection. Only the first call has any effect.
+func (c *WSConn[Recv, Send]) Close(code int, text string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		if len(text) > maxCloseTextBytes {
+			text = text[:maxCloseTextBytes]
+		}
+		deadline := time.Now().Add(c.settings.writeTimeout)
+		err = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline)
+		if err == nil {
+			select {
+			case <-c.ctx.Done():
+			case <-time.After(time.Until(deadline)):
+			}
+		}
+		_ = c.conn.Close()
+		c.cancel()
+	})
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return nil
+	}
+	return err
+}
+
+// maxCloseTextBytes is the most text a close frame can hold
+const maxCloseTextBytes = 123
+
+func (c *WSConn[Recv, Send]) readLoop() {
+	defer c.cancel()
+	defer close(c.received)
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.readErr = c.readError(err)
+			_ = c.conn.Close()
+			return
+		}
+		if c.settings.pingInterval > 0 {
+			c.extendReadDeadline()
+		}
+		var item wsReceived[Recv]
+		if err := c.recvCodec.Unmarshal(data, &item.msg); err != nil {
+			item.err = &CloseError{Code: CloseUnsupportedData, Text: fmt.Sprintf("failed to decode message: %v", err)}
+		}
+		select {
+		case c.received <- item:
+		case <-c.closing: // nobody is receiving anymore, keep reading until the close frame
+		}
+	}
+}
+
+// readError maps the error that ended reading to what Receive returns
+func (c *WSConn[Recv, Send]) readError(err error) error {
+	select {
+	case <-c.closing:
+		return io.EOF
+	default:
+	}
+	if websocket.IsCloseError(err, CloseNormalClosure, CloseGoingAway) {
+		return io.EOF
+	}
+	return err
+}
+
+func (c *WSConn[Recv, Send]) pingLoop() {
+	ticker := time.NewTicker(c.settings.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.settings.writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *WSConn[Recv, Send]) extendReadDeadline() {
+	_ = c.conn.SetReadDeadline(time.Now().Add(c.settings.pingInterval + c.settings.writeTimeout))
+}
+
+// isTextMediaType returns true for media types sent as text frames
+func isTextMediaType(mediaType string) bool {
+	mediaType = baseMediaType(mediaType)
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == MediaTypeJson ||
+		mediaType == MediaTypeXml ||
+		mediaType == MediaTypeYaml ||
+		mediaType == MediaTypeForm
+}
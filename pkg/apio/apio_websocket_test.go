@@ -0,0 +1,183 @@
+package apio
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type chatPath struct {
+	_    any `path:"/rooms"`
+	Room string
+	_    any `path:"/chat"`
+}
+
+type chatQuery struct {
+	Name string
+}
+
+type chatIn struct {
+	Text string
+}
+
+type chatOut struct {
+	Room string
+	From string
+	Text string
+}
+
+type chatInput = EndpointInput[X, chatPath, chatQuery, X]
+
+type chatEndpointT = WSEndpoint[chatInput, chatIn, chatOut]
+
+var chatEndpoint = chatEndpointT{
+	Endpoint: Endpoint[chatInput, WebSocketOutput]{
+		Method: http.MethodGet,
+	},
+}
+
+func echoChat(ctx context.Context, input chatInput, conn *WSConn[chatIn, chatOut]) error {
+	for {
+		msg, err := conn.Receive()
+		if err != nil {
+			return err
+		}
+		if msg.Text == "bye" {
+			return &CloseError{Code: ClosePolicyViolation, Text: "bye yourself"}
+		}
+		err = conn.Send(chatOut{Room: input.Path.Room, From: input.Query.Name, Text: msg.Text})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func dialChat(t *testing.T, endpoint chatEndpointT, server Server) *WSConn[chatOut, chatIn] {
+	input := NewInput(Empty, chatPath{Room: "lobby"}, chatQuery{Name: "bob"}, Empty)
+	conn, err := endpoint.Dial(context.Background(), server, input, DefaultOpts())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return conn
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	for _, mediaType := range []string{MediaTypeJson, MediaTypeMsgPack} {
+		t.Run(mediaType, func(t *testing.T) {
+			endpoint := chatEndpoint.WithSocketHandler(echoChat)
+			endpoint.Consumes = []string{mediaType}
+			endpoint.Produces = []string{mediaType}
+			api := Api{Name: "ws"}.WithEndpoints(endpoint).Validate(true)
+			server := startTestServer(t, &api)
+
+			conn := dialChat(t, endpoint, server)
+			received := make([]chatOut, 0)
+			for _, text := range []string{"hi", "there"} {
+				if err := conn.Send(chatIn{Text: text}); err != nil {
+					t.Fatalf("failed to send: %v", err)
+				}
+				msg, err := conn.Receive()
+				if err != nil {
+					t.Fatalf("failed to receive: %v", err)
+				}
+				received = append(received, msg)
+			}
+			if err := conn.Close(CloseNormalClosure, ""); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+
+			expected := []chatOut{
+				{Room: "lobby", From: "bob", Text: "hi"},
+				{Room: "lobby", From: "bob", Text: "there"},
+			}
+			if diff := cmp.Diff(expected, received); diff != "" {
+				t.Fatalf("unexpected messages (-want +got):\n%s", diff)
+			}
+			if _, err := conn.Receive(); err != io.EOF {
+				t.Fatalf("expected io.EOF after close, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWebSocketCloseCodes(t *testing.T) {
+	api := Api{Name: "ws"}.WithEndpoints(chatEndpoint.WithSocketHandler(echoChat)).Validate(true)
+	server := startTestServer(t, &api)
+
+	conn := dialChat(t, chatEndpoint, server)
+	defer func() { _ = conn.Close(CloseNormalClosure, "") }()
+	if err := conn.Send(chatIn{Text: "bye"}); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	_, err := conn.Receive()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("expected a close error, got %v", err)
+	}
+	if closeErr.Code != ClosePolicyViolation || closeErr.Text != "bye yourself" {
+		t.Fatalf("unexpected close: %v", closeErr)
+	}
+	<-conn.Context().Done()
+}
+
+func TestWebSocketPings(t *testing.T) {
+	endpoint := chatEndpoint.WithSocketHandler(func(ctx context.Context, input chatInput, conn *WSConn[chatIn, chatOut]) error {
+		<-ctx.Done() // never reads, pongs are still handled
+		return nil
+	})
+	endpoint.PingInterval = 20 * time.Millisecond
+	endpoint.WriteTimeout = 20 * time.Millisecond
+	api := Api{Name: "ws"}.WithEndpoints(endpoint).Validate(true)
+	server := startTestServer(t, &api)
+
+	conn := dialChat(t, endpoint, server)
+	defer func() { _ = conn.Close(CloseNormalClosure, "") }()
+	select {
+	case <-conn.Context().Done():
+		t.Fatalf("connection closed while answering pings")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	rejectGuests := func(endpoint EndpointBase, payload InputPayload, next HandleFunc) (EndpointOutputBase, error) {
+		if payload.Query["Name"][0] == "guest" {
+			return nil, NewError(http.StatusForbidden, "guests may not chat", nil)
+		}
+		return next(payload)
+	}
+	api := Api{Name: "ws"}.WithEndpoints(chatEndpoint.WithSocketHandler(echoChat)).WithMiddlewares(rejectGuests).Validate(true)
+	server := startTestServer(t, &api)
+
+	input := NewInput(Empty, chatPath{Room: "lobby"}, chatQuery{Name: "guest"}, Empty)
+	_, err := chatEndpoint.Dial(context.Background(), server, input, DefaultOpts())
+	var errResp ErrResp
+	if !errors.As(err, &errResp) || errResp.Status != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %v", err)
+	}
+
+	// requests that aren't websocket handshakes are rejected by the upgrade
+	resp, err := http.Get(requestUrl(server, InputPayload{PathStr: "/rooms/lobby/chat", Query: map[string][]string{"Name": {"bob"}}}))
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebSocketValidate(t *testing.T) {
+	endpoint := chatEndpoint.WithSocketHandler(echoChat)
+	endpoint.Method = http.MethodPost
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected validation to panic for non-GET websocket endpoint")
+		}
+	}()
+	Api{Name: "ws"}.WithEndpoints(endpoint).Validate(true)
+}
@@ -1,11 +1,12 @@
 package openapi3
 
 import (
-	"fmt"
 	"github.com/GiGurra/apio/pkg/apio"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type OpenApi struct {
@@ -32,7 +33,19 @@ type Parameter struct {
 	In          string         `json:"in" yaml:"in" text:"in"`
 	Description string         `json:"description" yaml:"description" text:"description"`
 	Required    bool           `json:"required" yaml:"required" text:"required"`
+	Deprecated  bool           `json:"deprecated,omitempty" yaml:"deprecated,omitempty" text:"deprecated,omitempty"`
+	Style       string         `json:"style,omitempty" yaml:"style,omitempty" text:"style,omitempty"`
+	Explode     bool           `json:"explode,omitempty" yaml:"explode,omitempty" text:"explode,omitempty"`
 	Schema      map[string]any `json:"schema" yaml:"schema" text:"schema"`
+	Example     any            `json:"example,omitempty" yaml:"example,omitempty" text:"example,omitempty"`
+}
+
+type Header struct {
+	Description string         `json:"description" yaml:"description" text:"description"`
+	Required    bool           `json:"required,omitempty" yaml:"required,omitempty" text:"required,omitempty"`
+	Deprecated  bool           `json:"deprecated,omitempty" yaml:"deprecated,omitempty" text:"deprecated,omitempty"`
+	Schema      map[string]any `json:"schema" yaml:"schema" text:"schema"`
+	Example     any            `json:"example,omitempty" yaml:"example,omitempty" text:"example,omitempty"`
 }
 
 type RequestBody struct {
@@ -41,21 +54,46 @@ type RequestBody struct {
 }
 
 type Response struct {
-	Description string         `json:"description" yaml:"description" text:"description"`
-	Content     map[string]any `json:"content" yaml:"content" text:"content"`
+	Description string            `json:"description" yaml:"description" text:"description"`
+	Headers     map[string]Header `json:"headers,omitempty" yaml:"headers,omitempty" text:"headers,omitempty"`
+	Content     map[string]any    `json:"content" yaml:"content" text:"content"`
+	// Messages describes the messages of WebSocket endpoints, as an extension
+	Messages map[string]any `json:"x-messages,omitempty" yaml:"x-messages,omitempty" text:"x-messages,omitempty"`
 }
 
 type Operation struct {
-	Summary     string              `json:"summary" yaml:"summary" text:"summary"`
-	Description string              `json:"description" yaml:"description" text:"description"`
-	OperationId string              `json:"operationId" yaml:"operationId" text:"operation_id"`
-	Parameters  []Parameter         `json:"parameters" yaml:"parameters" text:"parameters"`
-	RequestBody *RequestBody        `json:"requestBody,omitempty" yaml:"requestBody,omitempty" text:"requestBody,omitempty"`
-	Responses   map[string]Response `json:"responses" yaml:"responses" text:"responses"`
-	Tags        []string            `json:"tags,omitempty" yaml:"tags,omitempty" text:"tags,omitempty"`
+	Summary     string                `json:"summary" yaml:"summary" text:"summary"`
+	Description string                `json:"description" yaml:"description" text:"description"`
+	OperationId string                `json:"operationId" yaml:"operationId" text:"operation_id"`
+	Parameters  []Parameter           `json:"parameters" yaml:"parameters" text:"parameters"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty" yaml:"requestBody,omitempty" text:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses" yaml:"responses" text:"responses"`
+	Tags        []string              `json:"tags,omitempty" yaml:"tags,omitempty" text:"tags,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty" yaml:"security,omitempty" text:"security,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type" yaml:"type" text:"type"`
+	Description  string `json:"description,omitempty" yaml:"description,omitempty" text:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty" yaml:"scheme,omitempty" text:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty" yaml:"bearerFormat,omitempty" text:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty" yaml:"name,omitempty" text:"name,omitempty"`
+	In           string `json:"in,omitempty" yaml:"in,omitempty" text:"in,omitempty"`
+}
+
+// Options configure how the OpenAPI 3 spec is generated
+type Options struct {
+	// Naming decides the names of component schemas. Defaults to ShortNames
+	Naming NamingStrategy
 }
 
 func ToOpenApi3(api apio.Api) OpenApi {
+	return ToOpenApi3WithOptions(api, Options{})
+}
+
+func ToOpenApi3WithOptions(api apio.Api, opts Options) OpenApi {
+
+	registry := NewSchemaRegistry().WithNaming(opts.Naming)
 
 	servers := make([]Server, len(api.Servers))
 	for i, server := range api.Servers {
@@ -73,12 +111,14 @@ func ToOpenApi3(api apio.Api) OpenApi {
 			"version":     api.Version,
 		},
 		Servers:    servers,
-		Paths:      GetPaths(api),
-		Components: GetComponentsOfApi(api),
+		Paths:      registry.paths(api),
+		Components: registry.componentsOfApi(api),
 	}
 }
 
-func apioPattern2OpenApi3Pattern(pattern string) string {
+// apioPattern2OpenApi3Pattern converts a path pattern, naming the catch-all
+// segment after its field, since OpenAPI has no multi-segment parameters
+func apioPattern2OpenApi3Pattern(pattern string, catchAll string) string {
 
 	result := ""
 	for _, part := range strings.Split(pattern, "/") {
@@ -88,6 +128,8 @@ func apioPattern2OpenApi3Pattern(pattern string) string {
 		}
 		if trimmed[0] == ':' {
 			result += "/{" + trimmed[1:] + "}"
+		} else if trimmed == "*" && catchAll != "" {
+			result += "/{" + catchAll + "}"
 		} else {
 			result += "/" + trimmed
 		}
@@ -95,32 +137,149 @@ func apioPattern2OpenApi3Pattern(pattern string) string {
 	return result
 }
 
-func goTypeToOpenapiSchemaRef(t reflect.Type) map[string]any {
+// withPattern returns a copy of the schema, with the pattern anchored since
+// values must match it fully
+func withPattern(schema map[string]any, pattern string) map[string]any {
+	result := make(map[string]any, len(schema)+1)
+	for k, v := range schema {
+		result[k] = v
+	}
+	result["pattern"] = "^(?:" + pattern + ")$"
+	return result
+}
+
+// catchAllOf returns the name of the catch-all path field, if any
+func catchAllOf(pathInfo apio.StructInfo) string {
+	for _, field := range pathInfo.Fields {
+		if field.IsCatchAll() {
+			return field.Name
+		}
+	}
+	return ""
+}
+
+var registeredSchemas = sync.Map{}
+
+var timeType = reflect.TypeOf(time.Time{})
+var bytesType = reflect.TypeOf([]byte{})
+var fileType = reflect.TypeOf(apio.File{})
+var streamType = reflect.TypeOf(apio.Stream{})
+var jsonPatchOperationType = reflect.TypeOf(apio.JSONPatchOperation{})
+
+// RegisterTypeSchema registers a fixed schema for a go type, e.g. for uuid-like
+// named types that should be rendered as {"type": "string", "format": "uuid"}.
+// Registered types are always inlined and never produce components.
+func RegisterTypeSchema(t reflect.Type, schema map[string]any) {
+	registeredSchemas.Store(t, schema)
+}
+
+// RegisterSchema is the generic version of RegisterTypeSchema
+func RegisterSchema[T any](schema map[string]any) {
+	RegisterTypeSchema(reflect.TypeOf((*T)(nil)).Elem(), schema)
+}
+
+func registeredSchemaOf(t reflect.Type) (map[string]any, bool) {
+	schema, ok := registeredSchemas.Load(t)
+	if !ok {
+		return nil, false
+	}
+	// copy, since callers may add description etc. to the result
+	result := make(map[string]any)
+	for k, v := range schema.(map[string]any) {
+		result[k] = v
+	}
+	return result, true
+}
+
+// isInlineType returns true for types that are rendered inline and never
+// produce components, even though they may be structs
+func isInlineType(t reflect.Type) bool {
+	if _, ok := registeredSchemas.Load(t); ok {
+		return true
+	}
+	return t == timeType || t == bytesType || t == fileType || t == streamType || t == jsonPatchOperationType
+}
+
+func (r *SchemaRegistry) schemaRefOf(t reflect.Type) map[string]any {
+	if schema, ok := registeredSchemaOf(t); ok {
+		return schema
+	}
+	if valueType, ok := apio.OptionalValueType(t); ok {
+		return nullableSchema(r.schemaRefOf(valueType))
+	}
+	if interfaceType, ok := apio.OneOfInterfaceType(t); ok {
+		return r.schemaRefOf(interfaceType)
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == bytesType:
+		return map[string]any{"type": "string", "format": "byte"}
+	case t == fileType || t == streamType:
+		return map[string]any{"type": "string", "format": "binary"}
+	case t == jsonPatchOperationType:
+		return map[string]any{
+			"type":     "object",
+			"required": []string{"op", "path"},
+			"properties": map[string]any{
+				"op":    map[string]any{"type": "string", "enum": []string{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  map[string]any{"type": "string"},
+				"from":  map[string]any{"type": "string"},
+				"value": map[string]any{"nullable": true},
+			},
+		}
+	}
 	switch t.Kind() {
 	case reflect.Pointer:
-		return goTypeToOpenapiSchemaRef(t.Elem())
-	case reflect.Slice:
+		return r.schemaRefOf(t.Elem())
+	case reflect.Slice, reflect.Array:
 		return map[string]any{
 			"type":  "array",
-			"items": goTypeToOpenapiSchemaRef(t.Elem()),
-		}
-	case reflect.Struct:
-		// Here we need to do further analysis
-		structInfo, err := apio.GetStructInfoOfType(t)
-		if err != nil {
-			panic(fmt.Errorf("failed to analyze struct: %v", err))
+			"items": r.schemaRefOf(t.Elem()),
 		}
+	case reflect.Map:
 		return map[string]any{
-			"$ref": "#/components/schemas/" + schemaNameOf(structInfo),
+			"type":                 "object",
+			"additionalProperties": r.schemaRefOf(t.Elem()),
+		}
+	case reflect.Interface:
+		if oneOf, ok := apio.GetOneOfInfo(t); ok {
+			return r.oneOfRefOf(oneOf)
 		}
+		// any value is allowed
+		return map[string]any{}
+	case reflect.Struct:
+		return r.structRefOf(t)
 	default:
-		return map[string]any{
+		result := map[string]any{
 			"type": goTypeToOpenapiType(t),
 		}
+		if format := goTypeToOpenapiFormat(t); format != "" {
+			result["format"] = format
+		}
+		return result
+	}
+}
+
+func goTypeToOpenapiFormat(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int32, reflect.Uint32:
+		return "int32"
+	case reflect.Int64, reflect.Uint64:
+		return "int64"
+	case reflect.Float32:
+		return "float"
+	case reflect.Float64:
+		return "double"
+	default:
+		return ""
 	}
 }
 
 func goTypeToOpenapiType(t reflect.Type) string {
+	if t == timeType || t == bytesType {
+		return "string"
+	}
 	switch t.Kind() {
 	case reflect.Bool:
 		return "boolean"
@@ -154,9 +313,11 @@ func goTypeToOpenapiType(t reflect.Type) string {
 		return "object"
 	case reflect.Struct:
 		return "object"
+	case reflect.Map:
+		return "object"
 	case reflect.Ptr:
 		return goTypeToOpenapiType(t.Elem())
-	case reflect.Slice:
+	case reflect.Slice, reflect.Array:
 		return "array"
 	default:
 		panic("unsupported type: " + t.String())
@@ -164,6 +325,10 @@ func goTypeToOpenapiType(t reflect.Type) string {
 }
 
 func GetParameters(api apio.EndpointBase) []Parameter {
+	return NewSchemaRegistry().parametersOf(api)
+}
+
+func (r *SchemaRegistry) parametersOf(api apio.EndpointBase) []Parameter {
 	result := make([]Parameter, 0)
 
 	for _, field := range api.GetInputHeaderInfo().Fields {
@@ -172,15 +337,11 @@ func GetParameters(api apio.EndpointBase) []Parameter {
 			continue
 		}
 
-		result = append(result, Parameter{
-			Name:        field.Name,
-			In:          "header",
-			Description: field.Name,
-			Required:    true,
-			Schema: map[string]any{
-				"type": goTypeToOpenapiType(field.ValueType),
-			},
-		})
+		if field.IsCookie() {
+			result = append(result, r.parameterOf(field, "cookie", field.IsRequired()))
+		} else {
+			result = append(result, r.parameterOf(field, "header", field.IsRequired() && !field.IsHeaderList()))
+		}
 	}
 
 	for _, field := range api.GetInputPathInfo().Fields {
@@ -189,15 +350,14 @@ func GetParameters(api apio.EndpointBase) []Parameter {
 			continue
 		}
 
-		result = append(result, Parameter{
-			Name:        field.Name,
-			In:          "path",
-			Description: field.Name,
-			Required:    true,
-			Schema: map[string]any{
-				"type": goTypeToOpenapiType(field.ValueType),
-			},
-		})
+		param := r.parameterOf(field, "path", true)
+		if field.IsCatchAll() {
+			param.Description += " (the rest of the path, which may contain slashes)"
+		}
+		if field.Pattern != "" {
+			param.Schema = withPattern(param.Schema, field.Pattern)
+		}
+		result = append(result, param)
 	}
 
 	for _, field := range api.GetInputQueryInfo().Fields {
@@ -206,52 +366,198 @@ func GetParameters(api apio.EndpointBase) []Parameter {
 			continue
 		}
 
-		result = append(result, Parameter{
-			Name:        field.Name,
-			In:          "query",
-			Description: field.Name,
-			Required:    field.IsRequired(),
-			Schema: map[string]any{
-				"type": goTypeToOpenapiType(field.ValueType),
-			},
-		})
+		param := r.parameterOf(field, "query", field.IsRequired())
+		param.Name = field.ParamName(api.GetQueryNaming())
+		if field.Description == "" {
+			param.Description = param.Name
+		}
+		if field.IsDeepObject() {
+			// e.g. filter[status]=active, absent maps are empty
+			param.Style = "deepObject"
+			param.Explode = true
+			param.Required = field.IsRequired() && field.ValueType.Kind() == reflect.Struct
+		}
+		result = append(result, param)
+	}
+
+	return result
+}
+
+// responseHeadersOf documents output headers. Content-Type is described by
+// the content, and cookie fields by a single Set-Cookie header.
+func (r *SchemaRegistry) responseHeadersOf(headersInfo apio.StructInfo) map[string]Header {
+	result := make(map[string]Header)
+	cookies := make([]string, 0)
+	for _, field := range headersInfo.Fields {
+		if field.LKName == "content-type" || !field.HasFieldNameInStruct() {
+			continue
+		}
+		if field.IsSetCookie() {
+			cookies = append(cookies, field.Name)
+			continue
+		}
+		description := field.Description
+		if description == "" {
+			description = field.Name
+		}
+		header := Header{
+			Description: description,
+			Required:    field.IsRequired() && !field.IsHeaderList(),
+			Deprecated:  field.Deprecated,
+			Schema:      r.schemaRefOf(field.ValueType),
+		}
+		if field.HasExample() {
+			header.Example = field.ExampleValue()
+		}
+		result[field.Name] = header
+	}
+	if len(cookies) > 0 {
+		result["Set-Cookie"] = Header{
+			Description: "Sets the cookies " + strings.Join(cookies, ", "),
+			Schema:      map[string]any{"type": "string"},
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func (r *SchemaRegistry) parameterOf(field apio.FieldInfo, in string, required bool) Parameter {
+	description := field.Description
+	if description == "" {
+		description = field.Name
+	}
+	param := Parameter{
+		Name:        field.Name,
+		In:          in,
+		Description: description,
+		Required:    required,
+		Deprecated:  field.Deprecated,
+		Schema:      r.schemaRefOf(field.ValueType),
+	}
+	if field.HasExample() {
+		param.Example = field.ExampleValue()
+	}
+	return param
+}
+
+// propertySchemaOf returns the schema of a struct field, including any
+// description, example and deprecation info from its struct tags
+func (r *SchemaRegistry) propertySchemaOf(field apio.FieldInfo) map[string]any {
+	schema := r.schemaRefOf(field.ValueType)
+	if field.IsNullable() {
+		schema = nullableSchema(schema)
+	}
+	if field.Description == "" && !field.HasExample() && !field.Deprecated {
+		return schema
+	}
+	if _, isRef := schema["$ref"]; isRef {
+		// siblings of $ref are ignored in OpenAPI 3.0, so we wrap it
+		schema = map[string]any{
+			"allOf": []any{schema},
+		}
+	}
+	if field.Description != "" {
+		schema["description"] = field.Description
+	}
+	if field.HasExample() {
+		schema["example"] = field.ExampleValue()
+	}
+	if field.Deprecated {
+		schema["deprecated"] = true
+	}
+	return schema
+}
+
+// nullableSchema allows null in addition to the values of schema
+func nullableSchema(schema map[string]any) map[string]any {
+	result := map[string]any{"nullable": true}
+	if _, isRef := schema["$ref"]; isRef {
+		// siblings of $ref are ignored in OpenAPI 3.0, so we wrap it
+		result["allOf"] = []any{schema}
+		return result
+	}
+	for k, v := range schema {
+		result[k] = v
 	}
+	return result
+}
 
+func examplesOf(examples map[string]apio.Example) map[string]any {
+	result := make(map[string]any, len(examples))
+	for name, example := range examples {
+		obj := map[string]any{
+			"value": example.Value,
+		}
+		if example.Summary != "" {
+			obj["summary"] = example.Summary
+		}
+		if example.Description != "" {
+			obj["description"] = example.Description
+		}
+		result[name] = obj
+	}
 	return result
 }
 
-func contentOfBodyInfo(bodyInfo apio.StructInfo) map[string]any {
+func (r *SchemaRegistry) contentOfBodyInfo(bodyInfo apio.StructInfo, examples map[string]apio.Example, mediaTypes []string) map[string]any {
 	if !bodyInfo.HasContent() {
 		return make(map[string]any)
 	}
+	mediaType := map[string]any{}
 	if bodyInfo.IsSlice {
-		return map[string]any{
-			"application/json": map[string]any{
-				"schema": map[string]any{
-					"type": "array",
-					"items": map[string]any{
-						"$ref": "#/components/schemas/" + schemaNameOf(bodyInfo),
-					},
-				},
-			},
+		mediaType["schema"] = map[string]any{
+			"type":  "array",
+			"items": r.schemaRefOf(bodyInfo.Type),
 		}
 	} else {
-		return map[string]any{
-			"application/json": map[string]any{
-				"schema": map[string]any{
-					"$ref": "#/components/schemas/" + schemaNameOf(bodyInfo),
-				},
+		mediaType["schema"] = r.schemaRefOf(bodyInfo.Type)
+	}
+	if len(examples) > 0 {
+		mediaType["examples"] = examplesOf(examples)
+	}
+	result := make(map[string]any, len(mediaTypes))
+	for _, name := range mediaTypes {
+		result[name] = mediaType
+	}
+	return result
+}
+
+// eventStreamContentOf describes Server-Sent Events as an array of their
+// data, since OpenAPI 3.0 has no notion of event streams
+func (r *SchemaRegistry) eventStreamContentOf(eventType reflect.Type) map[string]any {
+	return map[string]any{
+		apio.MediaTypeEventStream: map[string]any{
+			"schema": map[string]any{
+				"type":   "array",
+				"format": "event-stream",
+				"items":  r.schemaRefOf(eventType),
 			},
-		}
+		},
+	}
+}
+
+// webSocketMessagesOf describes the messages of a WebSocket endpoint,
+// since OpenAPI 3.0 has no notion of WebSockets
+func (r *SchemaRegistry) webSocketMessagesOf(ws apio.WebSocketEndpoint) map[string]any {
+	inbound, outbound := ws.GetMessageTypes()
+	return map[string]any{
+		"inbound":  r.schemaRefOf(inbound),
+		"outbound": r.schemaRefOf(outbound),
 	}
 }
 
 func GetPaths(api apio.Api) map[string]any {
+	return NewSchemaRegistry().paths(api)
+}
+
+func (r *SchemaRegistry) paths(api apio.Api) map[string]any {
 
 	result := make(map[string]any)
 	for _, e := range api.Endpoints {
-		path := apioPattern2OpenApi3Pattern(e.GetPathPattern())
-		if path[0] != '/' {
+		path := apioPattern2OpenApi3Pattern(e.GetPathPattern(), catchAllOf(e.GetInputPathInfo()))
+		if !strings.HasPrefix(path, "/") {
 			path = "/" + path
 		}
 		if _, ok := result[path]; !ok {
@@ -260,7 +566,19 @@ func GetPaths(api apio.Api) map[string]any {
 		methods := result[path].(map[string]any)
 
 		outputBodyInfo := e.GetBodyOutputInfo()
-		outputContent := contentOfBodyInfo(outputBodyInfo)
+		outputContent := r.contentOfBodyInfo(outputBodyInfo, e.GetResponseExamples(), e.GetProduces())
+		if sse, ok := e.(apio.EventStreamEndpoint); ok {
+			outputContent = r.eventStreamContentOf(sse.GetEventType())
+		}
+		outputDescription := e.GetOutput().GetDescription()
+		var outputMessages map[string]any
+		if ws, ok := e.(apio.WebSocketEndpoint); ok {
+			outputContent = nil
+			outputMessages = r.webSocketMessagesOf(ws)
+			if outputDescription == "" {
+				outputDescription = "Switching Protocols"
+			}
+		}
 
 		inputBodyInfo := e.GetBodyInputInfo()
 
@@ -269,18 +587,21 @@ func GetPaths(api apio.Api) map[string]any {
 			Description: e.GetDescription(),
 			OperationId: e.GetId(),
 			Tags:        e.GetTags(),
-			Parameters:  GetParameters(e),
+			Parameters:  r.parametersOf(e),
+			Security:    securityRequirementsOf(e),
 			Responses: map[string]Response{
 				strconv.Itoa(e.OkCode()): {
-					Description: e.GetOutput().GetDescription(),
+					Description: outputDescription,
+					Headers:     r.responseHeadersOf(e.GetOutput().GetHeadersInfo()),
 					Content:     outputContent,
+					Messages:    outputMessages,
 				},
 			},
 			RequestBody: func() *RequestBody {
 				if inputBodyInfo.HasContent() {
 					return &RequestBody{
 						Description: e.GetInput().GetDescription(),
-						Content:     contentOfBodyInfo(inputBodyInfo),
+						Content:     r.contentOfBodyInfo(inputBodyInfo, e.GetRequestExamples(), e.GetConsumes()),
 					}
 				} else {
 					return nil
@@ -293,83 +614,80 @@ func GetPaths(api apio.Api) map[string]any {
 }
 
 func GetComponentsOfType(t reflect.Type) map[string]any {
-	switch t.Kind() {
-	case reflect.Struct:
-		structInfo, err := apio.GetStructInfoOfType(t)
-		if err != nil {
-			panic(fmt.Errorf("failed to analyze struct: %v", err))
-		}
-		return GetComponentsOfStruct(structInfo)
-	case reflect.Slice:
-		return GetComponentsOfType(t.Elem())
-	default:
-		return make(map[string]any)
-	}
+	registry := NewSchemaRegistry()
+	registry.AddType(t)
+	return registry.Schemas()
 }
 
 func GetComponentsOfStruct(structInfo apio.StructInfo) map[string]any {
-	schemas := make(map[string]any)
-	if structInfo.HasContent() {
-		props := make(map[string]any)
-		required := make([]string, 0)
-
-		for _, field := range structInfo.Fields {
-			if !field.HasFieldNameInStruct() {
-				continue
-			}
-			props[field.Name] = goTypeToOpenapiSchemaRef(field.ValueType)
-			if field.IsRequired() {
-				required = append(required, field.Name)
-			}
-			newDefs := GetComponentsOfType(field.ValueType)
-			for k, v := range newDefs {
-				schemas[k] = v
-			}
-		}
-
-		schemas[schemaNameOf(structInfo)] = Schema{
-			Type:       "object",
-			Properties: props,
-			Required:   required,
-		}
-	}
-	return schemas
+	registry := NewSchemaRegistry()
+	registry.AddStruct(structInfo)
+	return registry.Schemas()
 }
 
 func GetComponentsOfApi(api apio.Api) map[string]any {
+	return NewSchemaRegistry().componentsOfApi(api)
+}
+
+func (r *SchemaRegistry) componentsOfApi(api apio.Api) map[string]any {
 
-	schemas := make(map[string]any)
 	for _, e := range api.Endpoints {
-		bodyInfos := []apio.StructInfo{
-			e.GetBodyOutputInfo(),
-			e.GetBodyInputInfo(),
-		}
-		for _, structInfo := range bodyInfos {
-			inner := GetComponentsOfStruct(structInfo)
-			for k, v := range inner {
-				schemas[k] = v
+		r.AddStruct(e.GetBodyInputInfo())
+		for _, field := range e.GetInputQueryInfo().Fields {
+			if field.IsDeepObject() {
+				r.AddType(field.ValueType)
 			}
 		}
+		if sse, ok := e.(apio.EventStreamEndpoint); ok {
+			r.AddType(sse.GetEventType())
+		}
+		if ws, ok := e.(apio.WebSocketEndpoint); ok {
+			inbound, outbound := ws.GetMessageTypes()
+			r.AddType(inbound)
+			r.AddType(outbound)
+		} else {
+			r.AddStruct(e.GetBodyOutputInfo())
+		}
 	}
 
-	return map[string]any{
-		"schemas": schemas,
+	result := map[string]any{
+		"schemas": r.Schemas(),
 	}
+	if securitySchemes := GetSecuritySchemes(api); len(securitySchemes) > 0 {
+		result["securitySchemes"] = securitySchemes
+	}
+	return result
 }
 
-func schemaNameOf(structInfo apio.StructInfo) string {
-	pkgParts := strings.Split(structInfo.Pkg, "/")
-	lastPart := pkgParts[len(pkgParts)-1]
-	raw := lastPart + "/" + structInfo.Name
-	// keep only alphanumeric characters, underscores and '-'s. Replace all other characters with '_'
-	return strings.Map(func(r rune) rune {
-		if r == '-' ||
-			r == '_' ||
-			(r >= 'a' && r <= 'z') ||
-			(r >= 'A' && r <= 'Z') ||
-			(r >= '0' && r <= '9') {
-			return r
+// GetSecuritySchemes returns all security schemes used by the api's endpoints, by name
+func GetSecuritySchemes(api apio.Api) map[string]SecurityScheme {
+	result := make(map[string]SecurityScheme)
+	for _, e := range api.Endpoints {
+		for _, scheme := range e.GetSecurity() {
+			result[scheme.Name] = SecurityScheme{
+				Type:         scheme.Type,
+				Description:  scheme.Description,
+				Scheme:       scheme.Scheme,
+				BearerFormat: scheme.BearerFormat,
+				Name:         scheme.ParamName,
+				In:           scheme.In,
+			}
+		}
+	}
+	return result
+}
+
+// securityRequirementsOf lists the alternative security requirements of an endpoint
+func securityRequirementsOf(e apio.EndpointBase) []map[string][]string {
+	result := make([]map[string][]string, 0, len(e.GetSecurity()))
+	for _, scheme := range e.GetSecurity() {
+		scopes := e.GetScopes()
+		if scopes == nil {
+			scopes = []string{}
 		}
-		return '_'
-	}, raw)
+		result = append(result, map[string][]string{
+			scheme.Name: scopes,
+		})
+	}
+	return result
 }
@@ -0,0 +1,463 @@
+package openapi3
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/GiGurra/apio/pkg/apio"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+func TestDescriptionsAndExamples(t *testing.T) {
+
+	type DocHeaders struct {
+		TraceId string `name:"X-Trace-Id" desc:"Trace id for the request" example:"abc-123"`
+	}
+
+	type DocPath struct {
+		_   any `path:"/pets"`
+		Pet int `desc:"The pet id" example:"42"`
+	}
+
+	type DocQuery struct {
+		Legacy *bool `desc:"Use the legacy format" deprecated:"true"`
+	}
+
+	type DocOwner struct {
+		Name string
+	}
+
+	type DocPet struct {
+		Name  string   `desc:"Name of the pet" example:"Fido"`
+		Age   int      `example:"3"`
+		Owner DocOwner `desc:"Owner of the pet"`
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[DocHeaders, DocPath, DocQuery, DocPet],
+		apio.EndpointOutput[apio.X, DocPet],
+	]{
+		Method: http.MethodPut,
+		ID:     "PutPet",
+		RequestExamples: map[string]apio.Example{
+			"fido": {Summary: "A dog", Value: DocPet{Name: "Fido", Age: 3}},
+		},
+		ResponseExamples: map[string]apio.Example{
+			"fido": {Description: "The stored dog", Value: DocPet{Name: "Fido", Age: 3}},
+		},
+	}
+
+	testApi := apio.Api{Name: "Docs"}.WithEndpoints(endpoint).Validate(false)
+
+	openApi3Str, err := json.Marshal(ToOpenApi3(testApi))
+	if err != nil {
+		t.Fatal(fmt.Errorf("failed to marshal OpenAPI 3 spec: %v", err))
+	}
+
+	var actual struct {
+		Paths map[string]map[string]struct {
+			Parameters  []map[string]any `json:"parameters"`
+			RequestBody map[string]any   `json:"requestBody"`
+			Responses   map[string]any   `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(openApi3Str, &actual)
+	if err != nil {
+		t.Fatal(fmt.Errorf("failed to unmarshal actual OpenAPI 3 spec: %v", err))
+	}
+
+	op := actual.Paths["/pets/{Pet}"]["put"]
+
+	expParams := []map[string]any{
+		{"name": "X-Trace-Id", "in": "header", "description": "Trace id for the request", "required": true, "schema": map[string]any{"type": "string"}, "example": "abc-123"},
+		{"name": "Pet", "in": "path", "description": "The pet id", "required": true, "schema": map[string]any{"type": "integer"}, "example": 42.0},
+		{"name": "Legacy", "in": "query", "description": "Use the legacy format", "required": false, "deprecated": true, "schema": map[string]any{"type": "boolean"}},
+	}
+	if diff := cmp.Diff(expParams, op.Parameters); diff != "" {
+		t.Fatalf("parameters mismatch:\n%s", diff)
+	}
+
+	expPetProps := map[string]any{
+		"Name":  map[string]any{"type": "string", "description": "Name of the pet", "example": "Fido"},
+		"Age":   map[string]any{"type": "integer", "example": 3.0},
+		"Owner": map[string]any{"allOf": []any{map[string]any{"$ref": "#/components/schemas/openapi3_DocOwner"}}, "description": "Owner of the pet"},
+	}
+	if diff := cmp.Diff(expPetProps, actual.Components.Schemas["openapi3_DocPet"]["properties"]); diff != "" {
+		t.Fatalf("schema properties mismatch:\n%s", diff)
+	}
+
+	expReqExamples := map[string]any{
+		"fido": map[string]any{"summary": "A dog", "value": map[string]any{"Name": "Fido", "Age": 3.0, "Owner": map[string]any{"Name": ""}}},
+	}
+	reqContent := op.RequestBody["content"].(map[string]any)["application/json"].(map[string]any)
+	if diff := cmp.Diff(expReqExamples, reqContent["examples"]); diff != "" {
+		t.Fatalf("request examples mismatch:\n%s", diff)
+	}
+
+	expRespExamples := map[string]any{
+		"fido": map[string]any{"description": "The stored dog", "value": map[string]any{"Name": "Fido", "Age": 3.0, "Owner": map[string]any{"Name": ""}}},
+	}
+	respContent := op.Responses["200"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)
+	if diff := cmp.Diff(expRespExamples, respContent["examples"]); diff != "" {
+		t.Fatalf("response examples mismatch:\n%s", diff)
+	}
+}
+
+func TestContentTypes(t *testing.T) {
+
+	type NotePath struct {
+		_ any `path:"/notes"`
+	}
+
+	type Note struct {
+		Title string
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, NotePath, apio.X, Note],
+		apio.EndpointOutput[apio.X, Note],
+	]{
+		Method:   http.MethodPost,
+		Consumes: []string{apio.MediaTypeJson, apio.MediaTypeXml},
+		Produces: []string{apio.MediaTypeYaml, apio.MediaTypeCbor},
+	}
+
+	testApi := apio.Api{Name: "ContentTypes"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/notes"].(map[string]any)["post"].(Operation)
+
+	requestTypes := make([]string, 0)
+	for mediaType := range operation.RequestBody.Content {
+		requestTypes = append(requestTypes, mediaType)
+	}
+	responseTypes := make([]string, 0)
+	for mediaType := range operation.Responses["200"].Content {
+		responseTypes = append(responseTypes, mediaType)
+	}
+	sort.Strings(requestTypes)
+	sort.Strings(responseTypes)
+
+	if diff := cmp.Diff([]string{"application/json", "application/xml"}, requestTypes); diff != "" {
+		t.Fatalf("request content mismatch:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"application/cbor", "application/yaml"}, responseTypes); diff != "" {
+		t.Fatalf("response content mismatch:\n%s", diff)
+	}
+}
+
+func TestFormContentType(t *testing.T) {
+
+	type LoginPath struct {
+		_ any `path:"/login"`
+	}
+
+	type Login struct {
+		User     string
+		Password string
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, LoginPath, apio.X, Login],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method:   http.MethodPost,
+		Consumes: []string{apio.MediaTypeForm},
+	}
+
+	testApi := apio.Api{Name: "Form"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/login"].(map[string]any)["post"].(Operation)
+
+	requestTypes := make([]string, 0)
+	for mediaType := range operation.RequestBody.Content {
+		requestTypes = append(requestTypes, mediaType)
+	}
+	if diff := cmp.Diff([]string{"application/x-www-form-urlencoded"}, requestTypes); diff != "" {
+		t.Fatalf("request content mismatch:\n%s", diff)
+	}
+}
+
+func TestMultipartSchema(t *testing.T) {
+
+	type UploadPath struct {
+		_ any `path:"/uploads"`
+	}
+
+	type Upload struct {
+		Title       string
+		Avatar      apio.File
+		Attachments []apio.File
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, UploadPath, apio.X, Upload],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method:   http.MethodPost,
+		Consumes: []string{apio.MediaTypeMultipart},
+	}
+
+	testApi := apio.Api{Name: "Uploads"}.WithEndpoints(endpoint).Validate(false)
+	spec, err := json.Marshal(ToOpenApi3(testApi))
+	if err != nil {
+		t.Fatalf("failed to marshal OpenAPI 3 spec: %v", err)
+	}
+	var actual struct {
+		Paths map[string]map[string]struct {
+			RequestBody struct {
+				Content map[string]any `json:"content"`
+			} `json:"requestBody"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &actual); err != nil {
+		t.Fatalf("failed to unmarshal OpenAPI 3 spec: %v", err)
+	}
+
+	if _, ok := actual.Paths["/uploads"]["post"].RequestBody.Content["multipart/form-data"]; !ok {
+		t.Fatalf("expected multipart/form-data request content")
+	}
+	expected := map[string]any{
+		"Title":       map[string]any{"type": "string"},
+		"Avatar":      map[string]any{"type": "string", "format": "binary"},
+		"Attachments": map[string]any{"type": "array", "items": map[string]any{"type": "string", "format": "binary"}},
+	}
+	if diff := cmp.Diff(expected, actual.Components.Schemas["openapi3_Upload"].Properties); diff != "" {
+		t.Fatalf("multipart schema mismatch:\n%s", diff)
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+
+	type DownloadPath struct {
+		_    any `path:"/files"`
+		Name string
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, DownloadPath, apio.X, apio.X],
+		apio.EndpointOutput[apio.X, apio.Stream],
+	]{
+		Method: http.MethodGet,
+	}
+
+	testApi := apio.Api{Name: "Downloads"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/files/{Name}"].(map[string]any)["get"].(Operation)
+
+	expected := map[string]any{
+		"application/octet-stream": map[string]any{
+			"schema": map[string]any{"type": "string", "format": "binary"},
+		},
+	}
+	if diff := cmp.Diff(expected, operation.Responses["200"].Content); diff != "" {
+		t.Fatalf("stream response mismatch:\n%s", diff)
+	}
+	if components := GetComponentsOfApi(testApi); len(components["schemas"].(map[string]any)) != 0 {
+		t.Fatalf("expected no schema components, got %v", components)
+	}
+}
+
+func TestEventStreamResponse(t *testing.T) {
+
+	type TicksPath struct {
+		_ any `path:"/ticks"`
+	}
+
+	type Tick struct {
+		N int
+	}
+
+	endpoint := apio.SSEEndpoint[apio.EndpointInput[apio.X, TicksPath, apio.X, apio.X], Tick]{
+		Endpoint: apio.Endpoint[apio.EndpointInput[apio.X, TicksPath, apio.X, apio.X], apio.EventStreamOutput]{
+			Method: http.MethodGet,
+		},
+	}
+
+	testApi := apio.Api{Name: "Events"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/ticks"].(map[string]any)["get"].(Operation)
+
+	expected := map[string]any{
+		"text/event-stream": map[string]any{
+			"schema": map[string]any{
+				"type":   "array",
+				"format": "event-stream",
+				"items":  map[string]any{"$ref": "#/components/schemas/openapi3_Tick"},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, operation.Responses["200"].Content); diff != "" {
+		t.Fatalf("event stream response mismatch:\n%s", diff)
+	}
+	schemas := GetComponentsOfApi(testApi)["schemas"].(map[string]any)
+	if _, ok := schemas["openapi3_Tick"]; !ok || len(schemas) != 1 {
+		t.Fatalf("expected only the event schema component, got %v", schemas)
+	}
+}
+
+func TestWebSocketResponse(t *testing.T) {
+
+	type ChatPath struct {
+		_ any `path:"/chat"`
+	}
+
+	type ChatIn struct {
+		Text string
+	}
+
+	type ChatOut struct {
+		From string
+		Text string
+	}
+
+	endpoint := apio.WSEndpoint[apio.EndpointInput[apio.X, ChatPath, apio.X, apio.X], ChatIn, ChatOut]{
+		Endpoint: apio.Endpoint[apio.EndpointInput[apio.X, ChatPath, apio.X, apio.X], apio.WebSocketOutput]{
+			Method: http.MethodGet,
+		},
+	}
+
+	testApi := apio.Api{Name: "Chat"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/chat"].(map[string]any)["get"].(Operation)
+
+	expected := map[string]Response{
+		"101": {
+			Description: "Switching Protocols",
+			Messages: map[string]any{
+				"inbound":  map[string]any{"$ref": "#/components/schemas/openapi3_ChatIn"},
+				"outbound": map[string]any{"$ref": "#/components/schemas/openapi3_ChatOut"},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, operation.Responses); diff != "" {
+		t.Fatalf("websocket response mismatch:\n%s", diff)
+	}
+	schemas := GetComponentsOfApi(testApi)["schemas"].(map[string]any)
+	if len(schemas) != 2 {
+		t.Fatalf("expected only the message schema components, got %v", schemas)
+	}
+}
+
+func TestItemsBodies(t *testing.T) {
+
+	type RecordsPath struct {
+		_ any `path:"/records"`
+	}
+
+	type Record struct {
+		Id int
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, RecordsPath, apio.X, apio.Items[Record]],
+		apio.EndpointOutput[apio.X, apio.Items[Record]],
+	]{
+		Method: http.MethodPost,
+	}
+
+	testApi := apio.Api{Name: "Records"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/records"].(map[string]any)["post"].(Operation)
+
+	schema := map[string]any{
+		"schema": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"$ref": "#/components/schemas/openapi3_Record"},
+		},
+	}
+	expected := map[string]any{
+		"application/x-ndjson": schema,
+		"application/json":     schema,
+	}
+	if diff := cmp.Diff(expected, operation.RequestBody.Content); diff != "" {
+		t.Fatalf("request body mismatch:\n%s", diff)
+	}
+	if diff := cmp.Diff(expected, operation.Responses["200"].Content); diff != "" {
+		t.Fatalf("response body mismatch:\n%s", diff)
+	}
+	schemas := GetComponentsOfApi(testApi)["schemas"].(map[string]any)
+	if _, ok := schemas["openapi3_Record"]; !ok || len(schemas) != 1 {
+		t.Fatalf("expected only the item schema component, got %v", schemas)
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+
+	type PageHeaders struct {
+		ContentType string       `name:"Content-Type"`
+		Total       int          `name:"X-Total" desc:"Total number of records"`
+		Next        *string      `name:"X-Next"`
+		Links       []string     `name:"Link"`
+		Session     http.Cookie  `name:"session"`
+		Theme       *http.Cookie `name:"theme"`
+		_           any          `name:"ignored"`
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, apio.X],
+		apio.EndpointOutput[PageHeaders, apio.X],
+	]{
+		Method: http.MethodGet,
+	}
+
+	testApi := apio.Api{Name: "Pages"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/"].(map[string]any)["get"].(Operation)
+
+	expected := map[string]Header{
+		"X-Total":    {Description: "Total number of records", Required: true, Schema: map[string]any{"type": "integer"}},
+		"X-Next":     {Description: "X-Next", Schema: map[string]any{"type": "string"}},
+		"Link":       {Description: "Link", Schema: map[string]any{"type": "array", "items": map[string]any{"type": "string"}}},
+		"Set-Cookie": {Description: "Sets the cookies session, theme", Schema: map[string]any{"type": "string"}},
+	}
+	if diff := cmp.Diff(expected, operation.Responses["204"].Headers); diff != "" {
+		t.Fatalf("unexpected response headers (-want +got):\n%s", diff)
+	}
+}
+
+func TestPatchBodies(t *testing.T) {
+
+	type PatchedUser struct {
+		Name string
+	}
+
+	mergeEndpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, apio.MergePatch[PatchedUser]],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method: http.MethodPatch,
+	}
+	jsonEndpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, apio.JSONPatch[PatchedUser]],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method: http.MethodPost,
+	}
+
+	testApi := apio.Api{Name: "Patches"}.WithEndpoints(mergeEndpoint, jsonEndpoint).Validate(false)
+	doc := ToOpenApi3(testApi)
+	operations := doc.Paths["/"].(map[string]any)
+
+	expectedMerge := map[string]any{
+		"application/merge-patch+json": map[string]any{
+			"schema": map[string]any{"$ref": "#/components/schemas/openapi3_PatchedUser"},
+		},
+	}
+	if diff := cmp.Diff(expectedMerge, operations["patch"].(Operation).RequestBody.Content); diff != "" {
+		t.Fatalf("unexpected merge patch content (-want +got):\n%s", diff)
+	}
+
+	jsonContent := operations["post"].(Operation).RequestBody.Content["application/json-patch+json"].(map[string]any)
+	items := jsonContent["schema"].(map[string]any)["items"].(map[string]any)
+	if diff := cmp.Diff([]string{"op", "path"}, items["required"]); diff != "" {
+		t.Fatalf("unexpected json patch operation schema (-want +got):\n%s", diff)
+	}
+
+	schemas := doc.Components["schemas"].(map[string]any)
+	if _, ok := schemas["openapi3_PatchedUser"]; !ok || len(schemas) != 1 {
+		t.Fatalf("expected only the PatchedUser component, got %v", schemas)
+	}
+}
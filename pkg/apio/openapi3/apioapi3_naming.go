@@ -0,0 +1,72 @@
+package openapi3
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// SchemaNamer can be implemented by body types (and types referenced by them)
+// to override the name of their component schema
+type SchemaNamer interface {
+	SchemaName() string
+}
+
+// NamingStrategy decides the component schema name of a named go type
+type NamingStrategy func(t reflect.Type) string
+
+var schemaNamerType = reflect.TypeOf((*SchemaNamer)(nil)).Elem()
+
+// pkgPathPrefix matches the package path segments in front of a qualified
+// type name, e.g. "github.com/GiGurra/apio/" in "github.com/GiGurra/apio/pkg.Body"
+var pkgPathPrefix = regexp.MustCompile(`[\w.\-~]+/`)
+
+// ShortNames names schemas <last pkg segment>_<type name>, with generic
+// type arguments rendered by their short names, e.g.
+// user_setting_Page_Body for user_setting.Page[user_setting.Body]
+func ShortNames(t reflect.Type) string {
+	pkgParts := strings.Split(t.PkgPath(), "/")
+	pkg := pkgParts[len(pkgParts)-1]
+	name := pkgPathPrefix.ReplaceAllString(t.Name(), "")
+	// don't repeat the package for type arguments declared in the same package
+	name = strings.ReplaceAll(name, "["+pkg+".", "[")
+	name = strings.ReplaceAll(name, ","+pkg+".", ",")
+	return sanitizeSchemaName(pkg + "_" + name)
+}
+
+// QualifiedNames names schemas by their full package path and type name.
+// Useful when several packages share the same last path segment.
+func QualifiedNames(t reflect.Type) string {
+	return sanitizeSchemaName(t.PkgPath() + "_" + t.Name())
+}
+
+// sanitizeSchemaName keeps only alphanumeric characters, underscores and '-'s.
+// Slices in generic type arguments become "List_", all other characters
+// are replaced with '_', and repeated '_'s are collapsed
+func sanitizeSchemaName(raw string) string {
+	raw = strings.ReplaceAll(raw, "[]", "List_")
+	mapped := strings.Map(func(r rune) rune {
+		if r == '-' ||
+			r == '_' ||
+			(r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, raw)
+	for strings.Contains(mapped, "__") {
+		mapped = strings.ReplaceAll(mapped, "__", "_")
+	}
+	return strings.Trim(mapped, "_")
+}
+
+func overriddenSchemaName(t reflect.Type) (string, bool) {
+	if t.Implements(schemaNamerType) {
+		return reflect.Zero(t).Interface().(SchemaNamer).SchemaName(), true
+	}
+	if reflect.PointerTo(t).Implements(schemaNamerType) {
+		return reflect.New(t).Interface().(SchemaNamer).SchemaName(), true
+	}
+	return "", false
+}
@@ -0,0 +1,150 @@
+package openapi3
+
+import (
+	"encoding/json"
+	"github.com/GiGurra/apio/pkg/apio"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type NamingPage[T any] struct {
+	Items []T
+	Next  *string
+}
+
+type NamingItem struct {
+	Id int
+}
+
+type NamingRenamed struct {
+	Id int
+}
+
+func (NamingRenamed) SchemaName() string {
+	return "Renamed"
+}
+
+func schemaNamesOfApi(t *testing.T, api apio.Api, opts Options) (map[string]any, []string) {
+	spec, err := json.Marshal(ToOpenApi3WithOptions(api, opts))
+	if err != nil {
+		t.Fatalf("failed to marshal OpenAPI 3 spec: %v", err)
+	}
+	var actual struct {
+		Paths      map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &actual); err != nil {
+		t.Fatalf("failed to unmarshal OpenAPI 3 spec: %v", err)
+	}
+	names := make([]string, 0)
+	for name := range actual.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return actual.Paths, names
+}
+
+func TestGenericAndOverriddenSchemaNames(t *testing.T) {
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, NamingRenamed],
+		apio.EndpointOutput[apio.X, NamingPage[NamingItem]],
+	]{
+		Method: http.MethodPost,
+		ID:     "PostNaming",
+	}
+
+	testApi := apio.Api{Name: "Naming"}.WithEndpoints(endpoint).Validate(false)
+
+	_, names := schemaNamesOfApi(t, testApi, Options{})
+	expNames := []string{"Renamed", "openapi3_NamingItem", "openapi3_NamingPage_NamingItem"}
+	if diff := cmp.Diff(expNames, names); diff != "" {
+		t.Fatalf("schema names mismatch:\n%s", diff)
+	}
+
+	_, names = schemaNamesOfApi(t, testApi, Options{Naming: QualifiedNames})
+	expNames = []string{
+		"Renamed",
+		"github_com_GiGurra_apio_pkg_apio_openapi3_NamingItem",
+		"github_com_GiGurra_apio_pkg_apio_openapi3_NamingPage_github_com_GiGurra_apio_pkg_apio_openapi3_NamingItem",
+	}
+	if diff := cmp.Diff(expNames, names); diff != "" {
+		t.Fatalf("schema names mismatch:\n%s", diff)
+	}
+}
+
+func TestGenericSliceArgSchemaName(t *testing.T) {
+	name := ShortNames(reflect.TypeOf(NamingPage[[]apio.X]{}))
+	if name != "openapi3_NamingPage_List_apio_X" {
+		t.Fatalf("unexpected schema name: %s", name)
+	}
+}
+
+func TestAnonymousStructsAreInlined(t *testing.T) {
+
+	type AnonBody = struct {
+		Inner struct {
+			Id int
+		}
+		Item NamingItem
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, AnonBody],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method: http.MethodPost,
+		ID:     "PostAnon",
+	}
+
+	testApi := apio.Api{Name: "Anon"}.WithEndpoints(endpoint).Validate(false)
+
+	paths, names := schemaNamesOfApi(t, testApi, Options{})
+	if diff := cmp.Diff([]string{"openapi3_NamingItem"}, names); diff != "" {
+		t.Fatalf("schema names mismatch:\n%s", diff)
+	}
+
+	schema := paths["/"].(map[string]any)["post"].(map[string]any)["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"]
+	expSchema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"Inner": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"Id": map[string]any{"type": "integer"}},
+				"required":   []any{"Id"},
+			},
+			"Item": map[string]any{"$ref": "#/components/schemas/openapi3_NamingItem"},
+		},
+		"required": []any{"Inner", "Item"},
+	}
+	if diff := cmp.Diff(expSchema, schema); diff != "" {
+		t.Fatalf("inline schema mismatch:\n%s", diff)
+	}
+}
+
+func TestSchemaNameCollision(t *testing.T) {
+
+	dup1 := func() reflect.Type {
+		type Dup struct{ A int }
+		return reflect.TypeOf(Dup{})
+	}()
+	dup2 := func() reflect.Type {
+		type Dup struct{ B int }
+		return reflect.TypeOf(Dup{})
+	}()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected schema name collision panic")
+		}
+	}()
+
+	registry := NewSchemaRegistry()
+	registry.AddType(dup1)
+	registry.AddType(dup2)
+}
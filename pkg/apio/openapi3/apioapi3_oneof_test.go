@@ -0,0 +1,87 @@
+package openapi3
+
+import (
+	"encoding/json"
+	"github.com/GiGurra/apio/pkg/apio"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+)
+
+type Expr interface {
+	isExpr()
+}
+
+type ExprConst struct {
+	Value int
+}
+
+func (ExprConst) isExpr() {}
+
+type ExprSum struct {
+	Terms []apio.OneOf[Expr]
+}
+
+func (ExprSum) isExpr() {}
+
+func TestOneOfSchema(t *testing.T) {
+
+	apio.RegisterOneOf[Expr]("type", apio.Variant[ExprConst]("const"), apio.Variant[ExprSum]("sum"))
+
+	type ExprBody struct {
+		Root apio.OneOf[Expr]
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, ExprBody],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method: http.MethodPost,
+		ID:     "PostExpr",
+	}
+
+	testApi := apio.Api{Name: "OneOf"}.WithEndpoints(endpoint).Validate(false)
+
+	spec, err := json.Marshal(ToOpenApi3(testApi))
+	if err != nil {
+		t.Fatalf("failed to marshal OpenAPI 3 spec: %v", err)
+	}
+	var actual struct {
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &actual); err != nil {
+		t.Fatalf("failed to unmarshal OpenAPI 3 spec: %v", err)
+	}
+
+	expOneOf := map[string]any{
+		"oneOf": []any{
+			map[string]any{"$ref": "#/components/schemas/openapi3_ExprConst"},
+			map[string]any{"$ref": "#/components/schemas/openapi3_ExprSum"},
+		},
+		"discriminator": map[string]any{
+			"propertyName": "type",
+			"mapping": map[string]any{
+				"const": "#/components/schemas/openapi3_ExprConst",
+				"sum":   "#/components/schemas/openapi3_ExprSum",
+			},
+		},
+	}
+	rootProp := actual.Components.Schemas["openapi3_ExprBody"]["properties"].(map[string]any)["Root"]
+	if diff := cmp.Diff(expOneOf, rootProp); diff != "" {
+		t.Fatalf("oneOf mismatch:\n%s", diff)
+	}
+
+	expSum := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"Terms": map[string]any{"type": "array", "items": expOneOf},
+			"type":  map[string]any{"type": "string", "enum": []any{"sum"}},
+		},
+		"required": []any{"Terms", "type"},
+	}
+	if diff := cmp.Diff(expSum, actual.Components.Schemas["openapi3_ExprSum"]); diff != "" {
+		t.Fatalf("variant schema mismatch:\n%s", diff)
+	}
+}
@@ -0,0 +1,146 @@
+package openapi3
+
+import (
+	"github.com/GiGurra/apio/pkg/apio"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+)
+
+func TestCatchAllPath(t *testing.T) {
+
+	type FilesPath struct {
+		_      any `path:"/buckets"`
+		Bucket string
+		_      any    `path:"/files"`
+		Rest   string `path:"*"`
+	}
+
+	endpoint := apio.Endpoint[apio.EndpointInput[apio.X, FilesPath, apio.X, apio.X], apio.EndpointOutput[apio.X, apio.X]]{
+		Method: http.MethodGet,
+	}
+
+	testApi := apio.Api{Name: "Files"}.WithEndpoints(endpoint).Validate(false)
+	paths := GetPaths(testApi)
+	methods, ok := paths["/buckets/{Bucket}/files/{Rest}"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected catch-all path to be named after its field, got %v", paths)
+	}
+
+	expected := []Parameter{
+		{Name: "Bucket", In: "path", Description: "Bucket", Required: true, Schema: map[string]any{"type": "string"}},
+		{Name: "Rest", In: "path", Description: "Rest (the rest of the path, which may contain slashes)", Required: true, Schema: map[string]any{"type": "string"}},
+	}
+	if diff := cmp.Diff(expected, methods["get"].(Operation).Parameters); diff != "" {
+		t.Fatalf("parameters mismatch:\n%s", diff)
+	}
+}
+
+func TestPathNamesAndPatterns(t *testing.T) {
+
+	type UserPath struct {
+		_    any    `path:"/users"`
+		User int    `name:"userId" pattern:"[0-9]+" desc:"The user"`
+		_    any    `path:"/settings"`
+		Cat  string `name:"settingCat" pattern:"[a-z]+|default"`
+	}
+
+	endpoint := apio.Endpoint[apio.EndpointInput[apio.X, UserPath, apio.X, apio.X], apio.EndpointOutput[apio.X, apio.X]]{
+		Method: http.MethodGet,
+	}
+
+	testApi := apio.Api{Name: "Users"}.WithEndpoints(endpoint).Validate(false)
+	paths := GetPaths(testApi)
+	methods, ok := paths["/users/{userId}/settings/{settingCat}"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected path to use parameter names, got %v", paths)
+	}
+
+	expected := []Parameter{
+		{Name: "userId", In: "path", Description: "The user", Required: true, Schema: map[string]any{"type": "integer", "pattern": "^(?:[0-9]+)$"}},
+		{Name: "settingCat", In: "path", Description: "settingCat", Required: true, Schema: map[string]any{"type": "string", "pattern": "^(?:[a-z]+|default)$"}},
+	}
+	if diff := cmp.Diff(expected, methods["get"].(Operation).Parameters); diff != "" {
+		t.Fatalf("parameters mismatch:\n%s", diff)
+	}
+}
+
+func TestQueryParameterNames(t *testing.T) {
+
+	type PageQuery struct {
+		PageSize int
+		SortBy   *string `name:"order" desc:"Sort order"`
+	}
+
+	endpoint := apio.Endpoint[apio.EndpointInput[apio.X, apio.X, PageQuery, apio.X], apio.EndpointOutput[apio.X, apio.X]]{
+		Method:      http.MethodGet,
+		QueryNaming: apio.SnakeCase,
+	}
+
+	testApi := apio.Api{Name: "Pages"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/"].(map[string]any)["get"].(Operation)
+
+	expected := []Parameter{
+		{Name: "page_size", In: "query", Description: "page_size", Required: true, Schema: map[string]any{"type": "integer"}},
+		{Name: "order", In: "query", Description: "Sort order", Required: false, Schema: map[string]any{"type": "string"}},
+	}
+	if diff := cmp.Diff(expected, operation.Parameters); diff != "" {
+		t.Fatalf("parameters mismatch:\n%s", diff)
+	}
+}
+
+func TestDeepObjectQueryParameters(t *testing.T) {
+
+	type StatusFilter struct {
+		Status string `name:"status"`
+	}
+
+	type FilterQuery struct {
+		Filter StatusFilter `name:"filter"`
+		Labels map[string]string
+	}
+
+	endpoint := apio.Endpoint[apio.EndpointInput[apio.X, apio.X, FilterQuery, apio.X], apio.EndpointOutput[apio.X, apio.X]]{
+		Method: http.MethodGet,
+	}
+
+	testApi := apio.Api{Name: "Filters"}.WithEndpoints(endpoint).Validate(false)
+	doc := ToOpenApi3(testApi)
+	operation := doc.Paths["/"].(map[string]any)["get"].(Operation)
+
+	expected := []Parameter{
+		{Name: "filter", In: "query", Description: "filter", Required: true, Style: "deepObject", Explode: true, Schema: map[string]any{"$ref": "#/components/schemas/openapi3_StatusFilter"}},
+		{Name: "Labels", In: "query", Description: "Labels", Required: false, Style: "deepObject", Explode: true, Schema: map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}}},
+	}
+	if diff := cmp.Diff(expected, operation.Parameters); diff != "" {
+		t.Fatalf("parameters mismatch:\n%s", diff)
+	}
+	if _, ok := doc.Components["schemas"].(map[string]any)["openapi3_StatusFilter"]; !ok {
+		t.Fatalf("expected a StatusFilter component, got %v", doc.Components["schemas"])
+	}
+}
+
+func TestHeaderParameters(t *testing.T) {
+
+	type ListHeaders struct {
+		Tags  []string `name:"X-Tags"`
+		Trace *string  `name:"X-Trace"`
+		Id    int      `name:"X-Id"`
+	}
+
+	endpoint := apio.Endpoint[apio.EndpointInput[ListHeaders, apio.X, apio.X, apio.X], apio.EndpointOutput[apio.X, apio.X]]{
+		Method: http.MethodGet,
+	}
+
+	testApi := apio.Api{Name: "Headers"}.WithEndpoints(endpoint).Validate(false)
+	operation := GetPaths(testApi)["/"].(map[string]any)["get"].(Operation)
+
+	expected := []Parameter{
+		{Name: "X-Tags", In: "header", Description: "X-Tags", Required: false, Schema: map[string]any{"type": "array", "items": map[string]any{"type": "string"}}},
+		{Name: "X-Trace", In: "header", Description: "X-Trace", Required: false, Schema: map[string]any{"type": "string"}},
+		{Name: "X-Id", In: "header", Description: "X-Id", Required: true, Schema: map[string]any{"type": "integer"}},
+	}
+	if diff := cmp.Diff(expected, operation.Parameters); diff != "" {
+		t.Fatalf("parameters mismatch:\n%s", diff)
+	}
+}
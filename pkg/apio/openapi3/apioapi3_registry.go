@@ -0,0 +1,215 @@
+package openapi3
+
+import (
+	"fmt"
+	"github.com/GiGurra/apio/pkg/apio"
+	"reflect"
+)
+
+// SchemaRegistry collects component schemas. Each go type is visited only
+// once, so recursive and mutually recursive types (also across packages)
+// are supported: any back-edge simply becomes a $ref to the component
+// being generated.
+type SchemaRegistry struct {
+	naming  NamingStrategy
+	schemas map[string]any
+	visited map[reflect.Type]bool
+	names   map[string]reflect.Type
+
+	discriminators []discriminatorOf
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		naming:  ShortNames,
+		schemas: make(map[string]any),
+		visited: make(map[reflect.Type]bool),
+		names:   make(map[string]reflect.Type),
+	}
+}
+
+// WithNaming sets the naming strategy of component schemas. nil means the default (ShortNames).
+func (r *SchemaRegistry) WithNaming(naming NamingStrategy) *SchemaRegistry {
+	if naming != nil {
+		r.naming = naming
+	}
+	return r
+}
+
+// Schemas returns all component schemas registered so far, by name
+func (r *SchemaRegistry) Schemas() map[string]any {
+	r.applyDiscriminators()
+	return r.schemas
+}
+
+// SchemaName returns the component name of the named type t. It panics if
+// another type already uses the same name.
+func (r *SchemaRegistry) SchemaName(t reflect.Type) string {
+	name, ok := overriddenSchemaName(t)
+	if !ok {
+		name = r.naming(t)
+	}
+	if existing, taken := r.names[name]; taken && existing != t {
+		panic(fmt.Sprintf(
+			"schema name collision: '%s' is used by both %v (%s) and %v (%s). Implement SchemaName() on one of them or use another naming strategy",
+			name, existing, existing.PkgPath(), t, t.PkgPath(),
+		))
+	}
+	r.names[name] = t
+	return name
+}
+
+// AddType registers the components needed to describe the type t
+func (r *SchemaRegistry) AddType(t reflect.Type) {
+	if isInlineType(t) {
+		return
+	}
+	if valueType, ok := apio.OptionalValueType(t); ok {
+		r.AddType(valueType)
+		return
+	}
+	if interfaceType, ok := apio.OneOfInterfaceType(t); ok {
+		r.AddType(interfaceType)
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		structInfo, err := apio.GetStructInfoOfType(t)
+		if err != nil {
+			panic(fmt.Errorf("failed to analyze struct: %v", err))
+		}
+		r.AddStruct(structInfo)
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Pointer:
+		r.AddType(t.Elem())
+	case reflect.Interface:
+		if oneOf, ok := apio.GetOneOfInfo(t); ok {
+			r.addOneOfVariants(oneOf)
+		}
+	}
+}
+
+// addOneOfVariants registers the components of all variants, making sure
+// each of them documents the discriminator property
+func (r *SchemaRegistry) addOneOfVariants(oneOf apio.OneOfInfo) {
+	for _, name := range oneOf.VariantNames() {
+		variantT := oneOf.Variants[name]
+		for variantT.Kind() == reflect.Pointer {
+			variantT = variantT.Elem()
+		}
+		r.AddType(variantT)
+		if variantT.Kind() == reflect.Struct && variantT.Name() != "" {
+			// Applied in Schemas(), since the variant schema may still be
+			// under construction here, if the variant is recursive
+			r.discriminators = append(r.discriminators, discriminatorOf{
+				variant:  variantT,
+				property: oneOf.Discriminator,
+				value:    name,
+			})
+		}
+	}
+}
+
+type discriminatorOf struct {
+	variant  reflect.Type
+	property string
+	value    string
+}
+
+func (r *SchemaRegistry) applyDiscriminators() {
+	for _, d := range r.discriminators {
+		name := r.SchemaName(d.variant)
+		schema, ok := r.schemas[name].(Schema)
+		if !ok {
+			continue
+		}
+		if _, exists := schema.Properties[d.property]; exists {
+			continue
+		}
+		if schema.Properties == nil {
+			schema.Properties = make(map[string]any)
+		}
+		schema.Properties[d.property] = map[string]any{
+			"type": "string",
+			"enum": []string{d.value},
+		}
+		schema.Required = append(schema.Required, d.property)
+		r.schemas[name] = schema
+	}
+}
+
+func (r *SchemaRegistry) oneOfRefOf(oneOf apio.OneOfInfo) map[string]any {
+	refs := make([]any, 0, len(oneOf.Variants))
+	mapping := make(map[string]any)
+	for _, name := range oneOf.VariantNames() {
+		ref := r.schemaRefOf(oneOf.Variants[name])
+		refs = append(refs, ref)
+		if refStr, ok := ref["$ref"]; ok {
+			mapping[name] = refStr
+		}
+	}
+	return map[string]any{
+		"oneOf": refs,
+		"discriminator": map[string]any{
+			"propertyName": oneOf.Discriminator,
+			"mapping":      mapping,
+		},
+	}
+}
+
+// AddStruct registers the component of the struct and of all types it references
+func (r *SchemaRegistry) AddStruct(structInfo apio.StructInfo) {
+	if !structInfo.HasContent() || isInlineType(structInfo.Type) {
+		return
+	}
+	if r.visited[structInfo.Type] {
+		return
+	}
+	r.visited[structInfo.Type] = true
+
+	schema := r.objectSchemaOf(structInfo)
+
+	// anonymous structs are always inlined, so they don't get a component
+	if structInfo.Type.Name() != "" {
+		r.schemas[r.SchemaName(structInfo.Type)] = schema
+	}
+}
+
+func (r *SchemaRegistry) objectSchemaOf(structInfo apio.StructInfo) Schema {
+	props := make(map[string]any)
+	required := make([]string, 0)
+
+	for _, field := range structInfo.Fields {
+		if !field.HasFieldNameInStruct() {
+			continue
+		}
+		props[field.Name] = r.propertySchemaOf(field)
+		if field.IsRequired() {
+			required = append(required, field.Name)
+		}
+		r.AddType(field.ValueType)
+	}
+
+	return Schema{
+		Type:       "object",
+		Properties: props,
+		Required:   required,
+	}
+}
+
+func (r *SchemaRegistry) structRefOf(t reflect.Type) map[string]any {
+	if t.Name() == "" {
+		structInfo, err := apio.GetStructInfoOfType(t)
+		if err != nil {
+			panic(fmt.Errorf("failed to analyze struct: %v", err))
+		}
+		schema := r.objectSchemaOf(structInfo)
+		return map[string]any{
+			"type":       schema.Type,
+			"properties": schema.Properties,
+			"required":   schema.Required,
+		}
+	}
+	return map[string]any{
+		"$ref": "#/components/schemas/" + r.SchemaName(t),
+	}
+}
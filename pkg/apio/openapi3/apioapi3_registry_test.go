@@ -0,0 +1,76 @@
+package openapi3
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"reflect"
+	"testing"
+)
+
+type RecNode struct {
+	Name     string
+	Children []RecNode
+	Parent   *RecNode
+}
+
+type RecDept struct {
+	Name      string
+	Employees []RecEmployee
+}
+
+type RecEmployee struct {
+	Name string
+	Dept *RecDept
+}
+
+func TestRecursiveType(t *testing.T) {
+	schemas := GetComponentsOfType(reflect.TypeOf(RecNode{}))
+
+	expected := map[string]any{
+		"openapi3_RecNode": Schema{
+			Type: "object",
+			Properties: map[string]any{
+				"Name": map[string]any{"type": "string"},
+				"Children": map[string]any{
+					"type":  "array",
+					"items": map[string]any{"$ref": "#/components/schemas/openapi3_RecNode"},
+				},
+				"Parent": map[string]any{"$ref": "#/components/schemas/openapi3_RecNode"},
+			},
+			Required: []string{"Name", "Children"},
+		},
+	}
+
+	if diff := cmp.Diff(expected, schemas); diff != "" {
+		t.Fatalf("schemas mismatch:\n%s", diff)
+	}
+}
+
+func TestMutuallyRecursiveTypes(t *testing.T) {
+	schemas := GetComponentsOfType(reflect.TypeOf([]RecDept{}))
+
+	expected := map[string]any{
+		"openapi3_RecDept": Schema{
+			Type: "object",
+			Properties: map[string]any{
+				"Name": map[string]any{"type": "string"},
+				"Employees": map[string]any{
+					"type":  "array",
+					"items": map[string]any{"$ref": "#/components/schemas/openapi3_RecEmployee"},
+				},
+			},
+			Required: []string{"Name", "Employees"},
+		},
+		"openapi3_RecEmployee": Schema{
+			Type: "object",
+			Properties: map[string]any{
+				"Name": map[string]any{"type": "string"},
+				"Dept": map[string]any{"$ref": "#/components/schemas/openapi3_RecDept"},
+			},
+			Required: []string{"Name"},
+		},
+	}
+
+	if diff := cmp.Diff(expected, schemas); diff != "" {
+		t.Fatalf("schemas mismatch:\n%s", diff)
+	}
+}
@@ -0,0 +1,90 @@
+package openapi3
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/GiGurra/apio/pkg/apio"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+)
+
+func TestSecuritySchemes(t *testing.T) {
+
+	type SecPath struct {
+		_ any `path:"/me"`
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, SecPath, apio.X, apio.X],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method:   http.MethodGet,
+		ID:       "GetMe",
+		Security: []apio.SecurityScheme{apio.BearerAuth("bearer"), apio.ApiKeyInHeader("apiKey", "X-Api-Key")},
+	}
+
+	testApi := apio.Api{Name: "Security"}.WithEndpoints(endpoint).Validate(false)
+
+	spec, err := json.Marshal(ToOpenApi3(testApi))
+	if err != nil {
+		t.Fatalf("failed to marshal OpenAPI 3 spec: %v", err)
+	}
+	var actual struct {
+		Paths map[string]map[string]struct {
+			Security any `json:"security"`
+		} `json:"paths"`
+		Components struct {
+			SecuritySchemes any `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &actual); err != nil {
+		t.Fatalf("failed to unmarshal OpenAPI 3 spec: %v", err)
+	}
+
+	expSchemes := map[string]any{
+		"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+		"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": "X-Api-Key"},
+	}
+	if diff := cmp.Diff(expSchemes, actual.Components.SecuritySchemes); diff != "" {
+		t.Fatalf("security schemes mismatch:\n%s", diff)
+	}
+
+	expSecurity := []any{
+		map[string]any{"bearer": []any{}},
+		map[string]any{"apiKey": []any{}},
+	}
+	if diff := cmp.Diff(expSecurity, actual.Paths["/me"]["get"].Security); diff != "" {
+		t.Fatalf("operation security mismatch:\n%s", diff)
+	}
+}
+
+func TestCookieParameters(t *testing.T) {
+
+	type CookieHeaders struct {
+		Session string  `name:"session_id" in:"cookie"`
+		Theme   *string `in:"cookie"`
+		TraceId string
+	}
+
+	type CookiePath struct {
+		_ any `path:"/cart"`
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[CookieHeaders, CookiePath, apio.X, apio.X],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method: http.MethodGet,
+	}
+
+	params := GetParameters(endpoint)
+	actual := make([]string, 0, len(params))
+	for _, p := range params {
+		actual = append(actual, fmt.Sprintf("%s:%s:%t", p.In, p.Name, p.Required))
+	}
+	expected := []string{"cookie:session_id:true", "cookie:Theme:false", "header:TraceId:true"}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("parameters mismatch:\n%s", diff)
+	}
+}
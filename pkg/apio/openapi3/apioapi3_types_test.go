@@ -0,0 +1,131 @@
+package openapi3
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/GiGurra/apio/pkg/apio"
+	"github.com/google/go-cmp/cmp"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type TypesUUID [16]byte
+
+func TestSchemaTypes(t *testing.T) {
+
+	RegisterSchema[TypesUUID](map[string]any{"type": "string", "format": "uuid"})
+
+	type TypesLabel struct {
+		Text string
+	}
+
+	type TypesBody struct {
+		Id        TypesUUID
+		CreatedAt time.Time
+		UpdatedAt *time.Time
+		Blob      []byte
+		Small     int32
+		Big       int64
+		Ratio     float32
+		Precise   float64
+		Count     int
+		Anything  any
+		Counts    map[string]int
+		Labels    map[string]TypesLabel
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, TypesBody],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method: http.MethodPost,
+		ID:     "PostTypes",
+	}
+
+	testApi := apio.Api{Name: "Types"}.WithEndpoints(endpoint).Validate(false)
+
+	openApi3Str, err := json.Marshal(ToOpenApi3(testApi))
+	if err != nil {
+		t.Fatal(fmt.Errorf("failed to marshal OpenAPI 3 spec: %v", err))
+	}
+
+	var actual struct {
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(openApi3Str, &actual)
+	if err != nil {
+		t.Fatal(fmt.Errorf("failed to unmarshal actual OpenAPI 3 spec: %v", err))
+	}
+
+	expProps := map[string]any{
+		"Id":        map[string]any{"type": "string", "format": "uuid"},
+		"CreatedAt": map[string]any{"type": "string", "format": "date-time"},
+		"UpdatedAt": map[string]any{"type": "string", "format": "date-time"},
+		"Blob":      map[string]any{"type": "string", "format": "byte"},
+		"Small":     map[string]any{"type": "integer", "format": "int32"},
+		"Big":       map[string]any{"type": "integer", "format": "int64"},
+		"Ratio":     map[string]any{"type": "number", "format": "float"},
+		"Precise":   map[string]any{"type": "number", "format": "double"},
+		"Count":     map[string]any{"type": "integer"},
+		"Anything":  map[string]any{},
+		"Counts":    map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "integer"}},
+		"Labels":    map[string]any{"type": "object", "additionalProperties": map[string]any{"$ref": "#/components/schemas/openapi3_TypesLabel"}},
+	}
+	if diff := cmp.Diff(expProps, actual.Components.Schemas["openapi3_TypesBody"]["properties"]); diff != "" {
+		t.Fatalf("schema properties mismatch:\n%s", diff)
+	}
+
+	expSchemaNames := []string{"openapi3_TypesBody", "openapi3_TypesLabel"}
+	for _, name := range expSchemaNames {
+		if _, ok := actual.Components.Schemas[name]; !ok {
+			t.Fatalf("missing schema %s", name)
+		}
+	}
+	if len(actual.Components.Schemas) != len(expSchemaNames) {
+		t.Fatalf("unexpected schemas: %v", actual.Components.Schemas)
+	}
+}
+
+func TestOptionalSchemas(t *testing.T) {
+
+	type PatchAddress struct {
+		City string
+	}
+
+	type PatchBody struct {
+		Name    apio.Optional[string]       `json:",omitzero" desc:"New name, null to clear"`
+		Address apio.Optional[PatchAddress] `json:",omitzero"`
+		Tags    []apio.Optional[int]
+		Id      int
+	}
+
+	endpoint := apio.Endpoint[
+		apio.EndpointInput[apio.X, apio.X, apio.X, PatchBody],
+		apio.EndpointOutput[apio.X, apio.X],
+	]{
+		Method: http.MethodPatch,
+	}
+
+	testApi := apio.Api{Name: "Patch"}.WithEndpoints(endpoint).Validate(false)
+	schemas := ToOpenApi3(testApi).Components["schemas"].(map[string]any)
+
+	expected := Schema{
+		Type: "object",
+		Properties: map[string]any{
+			"Name":    map[string]any{"type": "string", "nullable": true, "description": "New name, null to clear"},
+			"Address": map[string]any{"allOf": []any{map[string]any{"$ref": "#/components/schemas/openapi3_PatchAddress"}}, "nullable": true},
+			"Tags":    map[string]any{"type": "array", "items": map[string]any{"type": "integer", "nullable": true}},
+			"Id":      map[string]any{"type": "integer"},
+		},
+		Required: []string{"Tags", "Id"},
+	}
+	if diff := cmp.Diff(expected, schemas["openapi3_PatchBody"]); diff != "" {
+		t.Fatalf("schema mismatch:\n%s", diff)
+	}
+	if _, ok := schemas["openapi3_PatchAddress"]; !ok {
+		t.Fatalf("missing schema openapi3_PatchAddress, got %v", schemas)
+	}
+}